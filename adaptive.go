@@ -0,0 +1,65 @@
+package main
+
+import (
+	"github.com/alexa-infra/rayme/imageio"
+	. "github.com/alexa-infra/rayme/math"
+	. "github.com/alexa-infra/rayme/render"
+	"math"
+)
+
+const (
+	adaptiveBatch = 8
+	// adaptiveFloor keeps dark pixels from demanding samples forever, their
+	// error is measured relative to at least this luminance.
+	adaptiveFloor = 0.05
+)
+
+// pixelStats counts the samples of one pixel, with running sums of the
+// luminance and its square to estimate the variance.
+type pixelStats struct {
+	lum, lumSq float64
+	count      int
+}
+
+func (this *pixelStats) add(c *Vec3) {
+	l := Luminance(c)
+	this.lum += l
+	this.lumSq += l * l
+	this.count++
+}
+
+// relativeError is the standard error of the mean luminance relative to
+// the mean itself.
+func (this *pixelStats) relativeError() float64 {
+	if this.count < 2 {
+		return math.Inf(1)
+	}
+	n := float64(this.count)
+	mean := this.lum / n
+	variance := math.Max(this.lumSq/n-mean*mean, 0) * n / (n - 1)
+	return math.Sqrt(variance/n) / math.Max(mean, adaptiveFloor)
+}
+
+func (this *pixelStats) converged(threshold float64, maxSamples int) bool {
+	return this.count >= maxSamples || this.relativeError() < threshold
+}
+
+// sampleHeatmap shows the sample count of each pixel from blue (fewest) to
+// red (maxSamples).
+func sampleHeatmap(stats []pixelStats, width, height, maxSamples int) *imageio.FloatImage {
+	ramp := MakeColorRamp(
+		ColorStop{0.0, &Vec3{0, 0, 0.5}},
+		ColorStop{0.25, &Vec3{0, 0.2, 1}},
+		ColorStop{0.5, &Vec3{0, 1, 0.2}},
+		ColorStop{0.75, &Vec3{1, 1, 0}},
+		ColorStop{1.0, &Vec3{1, 0, 0}},
+	)
+	img := imageio.MakeFloatImage(width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := ramp.Eval(float64(stats[y*width+x].count) / float64(maxSamples))
+			img.Set(x, y, float32(c.X), float32(c.Y), float32(c.Z))
+		}
+	}
+	return img
+}
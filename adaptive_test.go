@@ -0,0 +1,73 @@
+package main
+
+import (
+	. "github.com/alexa-infra/rayme/math"
+	"math"
+	"testing"
+)
+
+func TestPixelStatsError(t *testing.T) {
+	p := &pixelStats{}
+	p.add(&Vec3{0.5, 0.5, 0.5})
+	if !math.IsInf(p.relativeError(), 1) || p.converged(0.1, 4) {
+		t.Errorf("one sample: error %g", p.relativeError())
+	}
+	for i := 0; i < 3; i++ {
+		p.add(&Vec3{0.5, 0.5, 0.5})
+	}
+	if p.relativeError() > 1e-9 || !p.converged(0.01, 100) {
+		t.Errorf("constant samples: error %g", p.relativeError())
+	}
+
+	noisy, dark := &pixelStats{}, &pixelStats{}
+	for i := 0; i < 100; i++ {
+		v := float64(2 * (i % 2))
+		noisy.add(&Vec3{v, v, v})
+		dark.add(&Vec3{v / 100, v / 100, v / 100})
+	}
+	// mean 1, sample variance 100/99
+	if want := math.Sqrt(1.0 / 99); math.Abs(noisy.relativeError()-want) > 1e-9 {
+		t.Errorf("noisy samples: error %g, want %g", noisy.relativeError(), want)
+	}
+	if noisy.converged(0.05, 200) || !noisy.converged(0.05, 100) {
+		t.Errorf("noisy samples should only stop at the sample budget")
+	}
+	// a mean of 0.01 is measured against the floor
+	if want := math.Sqrt(1.0/99) / 100 / adaptiveFloor; math.Abs(dark.relativeError()-want) > 1e-9 {
+		t.Errorf("dark samples: error %g, want %g", dark.relativeError(), want)
+	}
+}
+
+func TestAdaptivePasses(t *testing.T) {
+	r := testRenderer(t, testOptions("box", ""), 1)
+	renderPasses(r, 1)
+	base := len(r.samples)
+	maxSamples := 4 * base
+	needed := func(p *pixelStats) bool { return !p.converged(0.02, maxSamples) }
+	for r.renderPass("test", adaptiveBatch, needed) > 0 {
+	}
+	heatmap := sampleHeatmap(r.stats, r.width, r.height, maxSamples)
+	if heatmap.Width != r.width || heatmap.Height != r.height {
+		t.Fatalf("heatmap is %dx%d, image %dx%d", heatmap.Width, heatmap.Height, r.width, r.height)
+	}
+	more := 0
+	for i, p := range r.stats {
+		if p.count < base || p.count >= maxSamples+adaptiveBatch || (p.count-base)%adaptiveBatch != 0 {
+			t.Fatalf("pixel %d took %d samples", i, p.count)
+		}
+		if needed(&p) {
+			t.Fatalf("pixel %d stopped before converging: %d samples, error %g", i, p.count, p.relativeError())
+		}
+		if p.count > base {
+			more++
+		}
+		if p.count >= maxSamples {
+			if c := heatmap.Pix[3*i : 3*i+3]; c[0] != 1 || c[1] != 0 || c[2] != 0 {
+				t.Errorf("pixel %d at the budget is %v on the heatmap", i, c)
+			}
+		}
+	}
+	if more == 0 || more == len(r.stats) {
+		t.Errorf("%d of %d pixels took extra samples", more, len(r.stats))
+	}
+}
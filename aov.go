@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"github.com/alexa-infra/rayme/imageio"
+	. "github.com/alexa-infra/rayme/math"
+	. "github.com/alexa-infra/rayme/render"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// aovPass is one auxiliary image. Averaged passes accumulate in a film
+// with the filter of the beauty pass, the others (IDs) are taken from the
+// centre sample only. Geometric passes are rendered by the first pass,
+// light passes by every pass.
+// Light passes read a component of the radiance instead of the first hit.
+// Hidden passes are only rendered as denoiser guides and are not written.
+type aovPass struct {
+	name     string
+	channels []string
+	averaged bool
+	hidden   bool
+	value    func(a *Aov) [3]float64
+	radiance func(c *RadianceComponents) *Vec3
+	film     *Film
+	img      *imageio.FloatImage
+}
+
+var (
+	aovPassNames   = []string{"depth", "normal", "position", "albedo", "uv", "material", "object"}
+	lightPassNames = []string{"emission", "diffuseDirect", "diffuseIndirect", "specularDirect", "specularIndirect", "transmission"}
+)
+
+func makeLightPass(name string, radiance func(c *RadianceComponents) *Vec3) *aovPass {
+	return &aovPass{name: name, channels: []string{"R", "G", "B"}, averaged: true, radiance: radiance}
+}
+
+func makeAovPass(name string) (*aovPass, error) {
+	switch name {
+	case "emission":
+		return makeLightPass(name, func(c *RadianceComponents) *Vec3 { return c.Emission }), nil
+	case "diffuseDirect":
+		return makeLightPass(name, func(c *RadianceComponents) *Vec3 { return c.DirectDiffuse }), nil
+	case "diffuseIndirect":
+		return makeLightPass(name, func(c *RadianceComponents) *Vec3 { return c.IndirectDiffuse }), nil
+	case "specularDirect":
+		return makeLightPass(name, func(c *RadianceComponents) *Vec3 { return c.DirectSpecular }), nil
+	case "specularIndirect":
+		return makeLightPass(name, func(c *RadianceComponents) *Vec3 { return c.IndirectSpecular }), nil
+	case "transmission":
+		return makeLightPass(name, func(c *RadianceComponents) *Vec3 { return c.Transmission }), nil
+	case "depth":
+		return &aovPass{name: name, channels: []string{"Z"}, averaged: true, value: func(a *Aov) [3]float64 {
+			return [3]float64{a.Depth, a.Depth, a.Depth}
+		}}, nil
+	case "normal":
+		return &aovPass{name: name, channels: []string{"X", "Y", "Z"}, averaged: true, value: func(a *Aov) [3]float64 {
+			return [3]float64{a.Normal.X, a.Normal.Y, a.Normal.Z}
+		}}, nil
+	case "position":
+		return &aovPass{name: name, channels: []string{"X", "Y", "Z"}, averaged: true, value: func(a *Aov) [3]float64 {
+			return [3]float64{a.Position.X, a.Position.Y, a.Position.Z}
+		}}, nil
+	case "albedo":
+		return &aovPass{name: name, channels: []string{"R", "G", "B"}, averaged: true, value: func(a *Aov) [3]float64 {
+			return [3]float64{a.Albedo.X, a.Albedo.Y, a.Albedo.Z}
+		}}, nil
+	case "uv":
+		return &aovPass{name: name, channels: []string{"U", "V"}, averaged: true, value: func(a *Aov) [3]float64 {
+			return [3]float64{a.U, a.V, 0}
+		}}, nil
+	case "material":
+		return &aovPass{name: name, channels: []string{"id"}, value: func(a *Aov) [3]float64 {
+			id := float64(a.MaterialId)
+			return [3]float64{id, id, id}
+		}}, nil
+	case "object":
+		return &aovPass{name: name, channels: []string{"id"}, value: func(a *Aov) [3]float64 {
+			id := float64(a.ObjectId)
+			return [3]float64{id, id, id}
+		}}, nil
+	}
+	return nil, fmt.Errorf("unknown AOV %q", name)
+}
+
+func parseAovPasses(spec string, width, height int, filter Filter) ([]*aovPass, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	names := []string{}
+	for _, name := range strings.Split(spec, ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "all":
+			names = append(names, aovPassNames...)
+		case "light":
+			names = append(names, lightPassNames...)
+		default:
+			names = append(names, name)
+		}
+	}
+	passes := []*aovPass{}
+	for _, name := range names {
+		pass, err := makeAovPass(name)
+		if err != nil {
+			return nil, err
+		}
+		pass.allocate(width, height, filter)
+		passes = append(passes, pass)
+	}
+	return passes, nil
+}
+
+// withDenoiseGuides adds the passes the denoiser needs unless they were
+// requested already.
+func withDenoiseGuides(passes []*aovPass, width, height int, filter Filter) []*aovPass {
+	for _, name := range []string{"albedo", "normal", "depth"} {
+		if findPass(passes, name) != nil {
+			continue
+		}
+		pass, _ := makeAovPass(name)
+		pass.hidden = true
+		pass.allocate(width, height, filter)
+		passes = append(passes, pass)
+	}
+	return passes
+}
+
+func (this *aovPass) allocate(width, height int, filter Filter) {
+	if this.averaged {
+		this.film = MakeFilm(width, height, filter)
+	} else {
+		this.img = imageio.MakeFloatImage(width, height)
+	}
+}
+
+// image resolves the pass.
+func (this *aovPass) image() *imageio.FloatImage {
+	if this.film != nil {
+		return this.film.Image()
+	}
+	return this.img
+}
+
+func findPass(passes []*aovPass, name string) *aovPass {
+	for _, pass := range passes {
+		if pass.name == name {
+			return pass
+		}
+	}
+	return nil
+}
+
+func visiblePasses(passes []*aovPass) []*aovPass {
+	visible := []*aovPass{}
+	for _, pass := range passes {
+		if !pass.hidden {
+			visible = append(visible, pass)
+		}
+	}
+	return visible
+}
+
+// addAovSample splats the passes of a sample taken at raster position
+// (x, y) for pixel (px, py), passes without a film take the centre sample
+// only. Passes whose input is nil are skipped.
+func addAovSample(passes []*aovPass, px, py int, x, y float64, a *Aov, c *RadianceComponents, centre bool) {
+	for _, pass := range passes {
+		var v *Vec3
+		if pass.radiance != nil {
+			if c == nil {
+				continue
+			}
+			v = pass.radiance(c)
+		} else {
+			if a == nil {
+				continue
+			}
+			t := pass.value(a)
+			v = &Vec3{t[0], t[1], t[2]}
+		}
+		if pass.film != nil {
+			pass.film.AddSample(x, y, v)
+		} else if centre {
+			pass.img.Set(px, py, float32(v.X), float32(v.Y), float32(v.Z))
+		}
+	}
+}
+
+func needsAov(passes []*aovPass) bool {
+	for _, pass := range passes {
+		if pass.value != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func needsRadianceComponents(passes []*aovPass) bool {
+	for _, pass := range passes {
+		if pass.radiance != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// writeRender writes the beauty image and its AOVs. EXR output gets the
+// passes as layers of the same file, other formats get one file per pass
+// next to the beauty image (PNG passes are stored as EXR, they are data).
+func writeRender(path string, img *imageio.FloatImage, passes []*aovPass, meta imageio.Metadata) error {
+	passes = visiblePasses(passes)
+	ext := strings.ToLower(filepath.Ext(path))
+	if len(passes) == 0 || ext != ".exr" {
+		if err := writeOutputWithMetadata(path, img, meta); err != nil {
+			return err
+		}
+		base := strings.TrimSuffix(path, filepath.Ext(path))
+		if ext == ".png" {
+			ext = ".exr"
+		}
+		for _, pass := range passes {
+			if err := writeOutput(base+"."+pass.name+ext, pass.image()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	opts, err := exrOptions()
+	if err != nil {
+		return err
+	}
+	opts.Metadata = meta
+	channels := splitChannels(img, "", []string{"R", "G", "B"})
+	for _, pass := range passes {
+		channels = append(channels, splitChannels(pass.image(), pass.name+".", pass.channels)...)
+	}
+	return writeFile(path, func(f *os.File) error {
+		return imageio.WriteEXRChannels(f, img.Width, img.Height, channels, opts)
+	})
+}
+
+func splitChannels(img *imageio.FloatImage, prefix string, names []string) []imageio.ExrChannel {
+	channels := make([]imageio.ExrChannel, len(names))
+	for c, name := range names {
+		data := make([]float32, img.Width*img.Height)
+		for i := range data {
+			data[i] = img.Pix[3*i+c]
+		}
+		channels[c] = imageio.ExrChannel{Name: prefix + name, Data: data}
+	}
+	return channels
+}
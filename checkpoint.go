@@ -0,0 +1,217 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checkpoint is the accumulation state of a render, passes [FirstPass,
+// Pass) of it. Pass and Seed are the generator state: every tile of a pass
+// reseeds from them.
+type checkpoint struct {
+	SceneHash     string
+	Width, Height int
+	Seed          int64
+	FirstPass     int
+	Pass          int
+	FinishedTiles [][4]int
+	FilmSum       []float64
+	FilmWeight    []float64
+	Lum, LumSq    []float64
+	Counts        []int
+	Aovs          []aovState
+}
+
+// aovState is the accumulation of one auxiliary pass, the film of an
+// averaged pass or the image of the others.
+type aovState struct {
+	FilmSum, FilmWeight []float64
+	Pix                 []float32
+}
+
+func (this *renderer) checkpoint() *checkpoint {
+	c := &checkpoint{
+		SceneHash: this.hash,
+		Width:     this.width,
+		Height:    this.height,
+		Seed:      this.seed,
+		FirstPass: this.firstPass,
+		Pass:      this.pass,
+		Lum:       make([]float64, len(this.stats)),
+		LumSq:     make([]float64, len(this.stats)),
+		Counts:    make([]int, len(this.stats)),
+	}
+	for t := range this.finished {
+		c.FinishedTiles = append(c.FinishedTiles, [4]int{t.x0, t.y0, t.x1, t.y1})
+	}
+	c.FilmSum, c.FilmWeight = this.film.Accumulation()
+	for i, p := range this.stats {
+		c.Lum[i], c.LumSq[i], c.Counts[i] = p.lum, p.lumSq, p.count
+	}
+	for _, pass := range this.passes {
+		state := aovState{}
+		if pass.film != nil {
+			state.FilmSum, state.FilmWeight = pass.film.Accumulation()
+		} else {
+			state.Pix = append([]float32{}, pass.img.Pix...)
+		}
+		c.Aovs = append(c.Aovs, state)
+	}
+	return c
+}
+
+func (this *renderer) restore(c *checkpoint) error {
+	if c.SceneHash != this.hash {
+		return fmt.Errorf("checkpoint was rendered with a different scene or settings")
+	}
+	if c.Width != this.width || c.Height != this.height {
+		return fmt.Errorf("checkpoint size mismatch")
+	}
+	if err := this.checkBuffers(c); err != nil {
+		return fmt.Errorf("checkpoint size mismatch: %v", err)
+	}
+	if err := this.film.AddAccumulation(c.FilmSum, c.FilmWeight); err != nil {
+		return err
+	}
+	for i := range this.stats {
+		this.stats[i] = pixelStats{c.Lum[i], c.LumSq[i], c.Counts[i]}
+	}
+	for i, pass := range this.passes {
+		if pass.film != nil {
+			if err := pass.film.AddAccumulation(c.Aovs[i].FilmSum, c.Aovs[i].FilmWeight); err != nil {
+				return err
+			}
+		} else {
+			copy(pass.img.Pix, c.Aovs[i].Pix)
+		}
+	}
+	this.seed, this.firstPass, this.pass = c.Seed, c.FirstPass, c.Pass
+	this.finished = map[tile]bool{}
+	for _, t := range c.FinishedTiles {
+		this.finished[tile{t[0], t[1], t[2], t[3]}] = true
+	}
+	return nil
+}
+
+// merge adds the accumulation of c to the render, c must come from the
+// same scene and settings. Films of averaged passes add up like the beauty
+// film. The other passes are written by the first pass only, they are
+// averaged over the merged renders that include it.
+func (this *renderer) merge(c *checkpoint) error {
+	if c.Width != this.width || c.Height != this.height {
+		return fmt.Errorf("resolution %dx%d does not match %dx%d", c.Width, c.Height, this.width, this.height)
+	}
+	if c.SceneHash != this.hash {
+		return fmt.Errorf("accumulation was rendered with a different scene or settings")
+	}
+	if err := this.checkBuffers(c); err != nil {
+		return fmt.Errorf("accumulation size mismatch: %v", err)
+	}
+	if err := this.film.AddAccumulation(c.FilmSum, c.FilmWeight); err != nil {
+		return err
+	}
+	for i := range this.stats {
+		p := &this.stats[i]
+		p.lum += c.Lum[i]
+		p.lumSq += c.LumSq[i]
+		p.count += c.Counts[i]
+	}
+	for i, pass := range this.passes {
+		if pass.film == nil {
+			continue
+		}
+		if err := pass.film.AddAccumulation(c.Aovs[i].FilmSum, c.Aovs[i].FilmWeight); err != nil {
+			return err
+		}
+	}
+	if c.FirstPass == 0 {
+		this.aovRenders++
+		t := float32(1) / float32(this.aovRenders)
+		for i, pass := range this.passes {
+			if pass.film != nil {
+				continue
+			}
+			for j, v := range c.Aovs[i].Pix {
+				pass.img.Pix[j] += (v - pass.img.Pix[j]) * t
+			}
+		}
+	}
+	return nil
+}
+
+// checkBuffers verifies the length of every buffer in c before any of it
+// is added, so a damaged checkpoint leaves the render untouched.
+func (this *renderer) checkBuffers(c *checkpoint) error {
+	n := len(this.stats)
+	lengths := []struct {
+		name      string
+		got, want int
+	}{
+		{"FilmSum", len(c.FilmSum), 3 * n},
+		{"FilmWeight", len(c.FilmWeight), n},
+		{"Lum", len(c.Lum), n},
+		{"LumSq", len(c.LumSq), n},
+		{"Counts", len(c.Counts), n},
+		{"Aovs", len(c.Aovs), len(this.passes)},
+	}
+	for _, l := range lengths {
+		if l.got != l.want {
+			return fmt.Errorf("%s has %d values, want %d", l.name, l.got, l.want)
+		}
+	}
+	for i, pass := range this.passes {
+		a := c.Aovs[i]
+		if pass.film != nil {
+			if len(a.FilmSum) != 3*n || len(a.FilmWeight) != n {
+				return fmt.Errorf("%s pass has %d and %d film values, want %d and %d", pass.name, len(a.FilmSum), len(a.FilmWeight), 3*n, n)
+			}
+		} else if len(a.Pix) != len(pass.img.Pix) {
+			return fmt.Errorf("%s pass has %d values, want %d", pass.name, len(a.Pix), len(pass.img.Pix))
+		}
+	}
+	return nil
+}
+
+// saveCheckpoint writes through a temporary file, so an interruption
+// never leaves a truncated checkpoint behind.
+func saveCheckpoint(path string, c *checkpoint) error {
+	tmp := path + ".tmp"
+	if err := writeFile(tmp, func(f *os.File) error {
+		return gob.NewEncoder(f).Encode(c)
+	}); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func loadCheckpoint(path string) (*checkpoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	c := &checkpoint{}
+	if err := gob.NewDecoder(f).Decode(c); err != nil {
+		return nil, fmt.Errorf("%s: %v", filepath.Base(path), err)
+	}
+	return c, nil
+}
+
+// sceneHash identifies the scene and the settings that shape the
+// accumulation buffers, renders can only be continued or merged when it
+// matches. The sampling seed is left out on purpose.
+func sceneHash(source []byte, f *frame, passes []*aovPass) string {
+	h := sha256.New()
+	h.Write(source)
+	names := []string{}
+	for _, pass := range passes {
+		names = append(names, pass.name)
+	}
+	fmt.Fprintf(h, "%d %d %d %s %g %d %s\n", f.width, f.height, len(f.samples)-1,
+		f.options.filter, f.options.filterRadius, f.options.tileSize, strings.Join(names, ","))
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func samePixels(t *testing.T, name string, got, want []float32) {
+	t.Helper()
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("%s differs at %d: %g, want %g", name, i, got[i], want[i])
+		}
+	}
+}
+
+func TestCheckpointResume(t *testing.T) {
+	opts := testOptions("box", "light,albedo,object")
+	full := testRenderer(t, opts, 7)
+	renderPasses(full, 3)
+
+	first := testRenderer(t, opts, 7)
+	renderPasses(first, 1)
+	path := filepath.Join(t.TempDir(), "render.ckpt")
+	if err := saveCheckpoint(path, first.checkpoint()); err != nil {
+		t.Fatal(err)
+	}
+	c, err := loadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resumed := testRenderer(t, opts, 0)
+	if err := resumed.restore(c); err != nil {
+		t.Fatal(err)
+	}
+	renderPasses(resumed, 3)
+
+	samePixels(t, "beauty", resumed.film.Image().Pix, full.film.Image().Pix)
+	for i, pass := range full.passes {
+		samePixels(t, pass.name, resumed.passes[i].image().Pix, pass.image().Pix)
+	}
+	for i, p := range full.stats {
+		if resumed.stats[i] != p {
+			t.Fatalf("pixel %d: stats %v, want %v", i, resumed.stats[i], p)
+		}
+	}
+}
+
+func TestCheckpointSizes(t *testing.T) {
+	opts := testOptions("box", "light,object")
+	source := testRenderer(t, opts, 1)
+	renderPasses(source, 1)
+	damage := []struct {
+		name string
+		cut  func(c *checkpoint)
+	}{
+		{"FilmSum", func(c *checkpoint) { c.FilmSum = c.FilmSum[1:] }},
+		{"FilmWeight", func(c *checkpoint) { c.FilmWeight = nil }},
+		{"Lum", func(c *checkpoint) { c.Lum = c.Lum[1:] }},
+		{"LumSq", func(c *checkpoint) { c.LumSq = c.LumSq[1:] }},
+		{"Counts", func(c *checkpoint) { c.Counts = c.Counts[1:] }},
+		{"Aovs", func(c *checkpoint) { c.Aovs = c.Aovs[1:] }},
+		{"emission", func(c *checkpoint) { c.Aovs[0].FilmWeight = c.Aovs[0].FilmWeight[1:] }},
+		{"object", func(c *checkpoint) { c.Aovs[len(c.Aovs)-1].Pix = nil }},
+	}
+	for _, d := range damage {
+		c := source.checkpoint()
+		d.cut(c)
+		r := testRenderer(t, opts, 1)
+		if err := r.restore(c); err == nil || !strings.Contains(err.Error(), d.name) {
+			t.Errorf("restore with short %s: %v", d.name, err)
+		}
+		if err := r.merge(c); err == nil || !strings.Contains(err.Error(), d.name) {
+			t.Errorf("merge with short %s: %v", d.name, err)
+		}
+		if r.samplesPerPixel() != 0 {
+			t.Errorf("%s: damaged checkpoint was partly added", d.name)
+		}
+	}
+}
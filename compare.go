@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/alexa-infra/rayme/imageio"
+	"math"
+)
+
+// compareCommand reports the difference between two linear images, e.g. a
+// render and its reference, and optionally writes the absolute difference.
+func compareCommand(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	diffPath := fs.String("diff", "", "Write absolute difference image to this file")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: rayme compare [-diff file] a b")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("compare needs two images")
+	}
+	a, err := imageio.ReadImage(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := imageio.ReadImage(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	if a.Width != b.Width || a.Height != b.Height {
+		return fmt.Errorf("size mismatch: %dx%d vs %dx%d", a.Width, a.Height, b.Width, b.Height)
+	}
+	diff := imageio.MakeFloatImage(a.Width, a.Height)
+	sum, maxDiff := 0.0, 0.0
+	for i := range a.Pix {
+		d := math.Abs(float64(a.Pix[i]) - float64(b.Pix[i]))
+		diff.Pix[i] = float32(d)
+		sum += d * d
+		maxDiff = math.Max(maxDiff, d)
+	}
+	rmse := math.Sqrt(sum / float64(len(a.Pix)))
+	psnr := math.Inf(1)
+	if rmse > 0 {
+		psnr = -20.0 * math.Log10(rmse)
+	}
+	fmt.Printf("RMSE %g\nPSNR %.2f dB\nmax %g\n", rmse, psnr, maxDiff)
+	if *diffPath != "" {
+		return writeOutput(*diffPath, diff)
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/alexa-infra/rayme/denoise"
+	"github.com/alexa-infra/rayme/imageio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func denoiseOptions() denoise.Options {
+	opts := denoise.MakeOptions()
+	opts.Iterations = *denoiseIters
+	opts.SigmaColor = *denoiseSigma
+	return opts
+}
+
+func denoiseGuides(passes []*aovPass) denoise.Guides {
+	guides := denoise.Guides{}
+	if pass := findPass(passes, "albedo"); pass != nil {
+		guides.Albedo = pass.image()
+	}
+	if pass := findPass(passes, "normal"); pass != nil {
+		guides.Normal = pass.image()
+	}
+	if pass := findPass(passes, "depth"); pass != nil {
+		guides.Depth = pass.image()
+	}
+	return guides
+}
+
+// denoiseCommand filters a saved render. Guides come from the albedo,
+// normal and depth layers of an EXR input, or from separate files.
+func denoiseCommand(args []string) error {
+	fs := flag.NewFlagSet("denoise", flag.ExitOnError)
+	albedoPath := fs.String("albedo", "", "Albedo guide image")
+	normalPath := fs.String("normal", "", "Normal guide image")
+	depthPath := fs.String("depth", "", "Depth guide image")
+	iterations := fs.Int("iterations", *denoiseIters, "Number of filter iterations")
+	sigma := fs.Float64("sigma", *denoiseSigma, "Colour edge sensitivity, larger values smooth more")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: rayme denoise [-albedo file] [-normal file] [-depth file] input output")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("denoise needs input and output images")
+	}
+	opts := denoise.MakeOptions()
+	opts.Iterations = *iterations
+	opts.SigmaColor = *sigma
+	if err := opts.Check(); err != nil {
+		return err
+	}
+	img, guides, err := readDenoiseInput(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	for _, guide := range []struct {
+		path  string
+		image **imageio.FloatImage
+	}{{*albedoPath, &guides.Albedo}, {*normalPath, &guides.Normal}, {*depthPath, &guides.Depth}} {
+		if guide.path == "" {
+			continue
+		}
+		if *guide.image, err = imageio.ReadImage(guide.path); err != nil {
+			return err
+		}
+		if (*guide.image).Width != img.Width || (*guide.image).Height != img.Height {
+			return fmt.Errorf("%s: size mismatch", guide.path)
+		}
+	}
+	out, err := denoise.Denoise(img, guides, opts)
+	if err != nil {
+		return err
+	}
+	return writeOutput(fs.Arg(1), out)
+}
+
+func readDenoiseInput(path string) (*imageio.FloatImage, denoise.Guides, error) {
+	guides := denoise.Guides{}
+	if strings.ToLower(filepath.Ext(path)) != ".exr" {
+		img, err := imageio.ReadImage(path)
+		return img, guides, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, guides, err
+	}
+	defer f.Close()
+	width, height, channels, err := imageio.ReadEXRChannels(f)
+	if err != nil {
+		return nil, guides, err
+	}
+	layer := func(names ...string) *imageio.FloatImage {
+		return joinChannels(width, height, channels, names)
+	}
+	img := layer("R", "G", "B")
+	if img == nil {
+		return nil, guides, fmt.Errorf("%s: no R, G, B channels", path)
+	}
+	guides.Albedo = layer("albedo.R", "albedo.G", "albedo.B")
+	guides.Normal = layer("normal.X", "normal.Y", "normal.Z")
+	guides.Depth = layer("depth.Z", "depth.Z", "depth.Z")
+	return img, guides, nil
+}
+
+func joinChannels(width, height int, channels []imageio.ExrChannel, names []string) *imageio.FloatImage {
+	img := imageio.MakeFloatImage(width, height)
+	for c, name := range names {
+		var data []float32
+		for _, ch := range channels {
+			if ch.Name == name {
+				data = ch.Data
+			}
+		}
+		if data == nil {
+			return nil
+		}
+		for i, v := range data {
+			img.Pix[3*i+c] = v
+		}
+	}
+	return img
+}
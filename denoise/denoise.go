@@ -0,0 +1,145 @@
+// Package denoise implements an edge-avoiding À-trous wavelet filter guided
+// by the albedo, normal and depth passes of a render.
+package denoise
+
+import (
+	"fmt"
+	"github.com/alexa-infra/rayme/imageio"
+	"math"
+)
+
+type Options struct {
+	Iterations  int
+	SigmaColor  float64
+	SigmaNormal float64
+	SigmaDepth  float64
+	SigmaAlbedo float64
+}
+
+func MakeOptions() Options {
+	return Options{Iterations: 5, SigmaColor: 0.6, SigmaNormal: 0.2, SigmaDepth: 0.5, SigmaAlbedo: 0.1}
+}
+
+// Check rejects options the filter can not run with, the weights divide
+// by every sigma.
+func (this Options) Check() error {
+	if this.Iterations < 0 {
+		return fmt.Errorf("denoise: iterations must not be negative")
+	}
+	if this.SigmaColor <= 0 || this.SigmaNormal <= 0 || this.SigmaDepth <= 0 || this.SigmaAlbedo <= 0 {
+		return fmt.Errorf("denoise: sigmas must be positive")
+	}
+	return nil
+}
+
+// Guides are the feature buffers used to find edges, any of them may be nil.
+type Guides struct {
+	Albedo *imageio.FloatImage
+	Normal *imageio.FloatImage
+	Depth  *imageio.FloatImage
+}
+
+var kernel = [5]float64{1.0 / 16, 1.0 / 4, 3.0 / 8, 1.0 / 4, 1.0 / 16}
+
+const albedoEpsilon = 0.01
+
+// Denoise filters img. Lighting is separated from texture by dividing by
+// the albedo first, so the filter does not blur texture detail.
+func Denoise(img *imageio.FloatImage, guides Guides, opts Options) (*imageio.FloatImage, error) {
+	if err := opts.Check(); err != nil {
+		return nil, err
+	}
+	w, h := img.Width, img.Height
+	cur := make([]float64, len(img.Pix))
+	for i, v := range img.Pix {
+		cur[i] = float64(v)
+		if guides.Albedo != nil {
+			cur[i] /= math.Max(float64(guides.Albedo.Pix[i]), albedoEpsilon)
+		}
+	}
+	next := make([]float64, len(cur))
+	for iter := 0; iter < opts.Iterations; iter++ {
+		step := 1 << uint(iter)
+		sigmaColor := opts.SigmaColor * math.Pow(2, -float64(iter)/2)
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				p := y*w + x
+				cp := compress(cur[3*p:])
+				var sum [3]float64
+				total := 0.0
+				for j := -2; j <= 2; j++ {
+					qy := y + j*step
+					if qy < 0 || qy >= h {
+						continue
+					}
+					for i := -2; i <= 2; i++ {
+						qx := x + i*step
+						if qx < 0 || qx >= w {
+							continue
+						}
+						q := qy*w + qx
+						weight := kernel[i+2] * kernel[j+2]
+						if q != p {
+							weight *= math.Exp(-distance2(cp, compress(cur[3*q:])) / (sigmaColor * sigmaColor))
+							weight *= guides.weight(p, q, step, opts)
+						}
+						sum[0] += weight * cur[3*q]
+						sum[1] += weight * cur[3*q+1]
+						sum[2] += weight * cur[3*q+2]
+						total += weight
+					}
+				}
+				next[3*p] = sum[0] / total
+				next[3*p+1] = sum[1] / total
+				next[3*p+2] = sum[2] / total
+			}
+		}
+		cur, next = next, cur
+	}
+	out := imageio.MakeFloatImage(w, h)
+	for i, v := range cur {
+		if guides.Albedo != nil {
+			v *= math.Max(float64(guides.Albedo.Pix[i]), albedoEpsilon)
+		}
+		out.Pix[i] = float32(v)
+	}
+	return out, nil
+}
+
+func (this Guides) weight(p, q, step int, opts Options) float64 {
+	weight := 1.0
+	if this.Normal != nil {
+		d := distance2(pixel(this.Normal, p), pixel(this.Normal, q))
+		weight *= math.Exp(-d / (opts.SigmaNormal * opts.SigmaNormal))
+	}
+	if this.Depth != nil {
+		zp, zq := float64(this.Depth.Pix[3*p]), float64(this.Depth.Pix[3*q])
+		scale := opts.SigmaDepth * float64(step) * math.Max(zp, 1e-3) * 0.05
+		weight *= math.Exp(-math.Abs(zp-zq) / scale)
+	}
+	if this.Albedo != nil {
+		d := distance2(pixel(this.Albedo, p), pixel(this.Albedo, q))
+		weight *= math.Exp(-d / (opts.SigmaAlbedo * opts.SigmaAlbedo))
+	}
+	return weight
+}
+
+func pixel(img *imageio.FloatImage, i int) [3]float64 {
+	return [3]float64{float64(img.Pix[3*i]), float64(img.Pix[3*i+1]), float64(img.Pix[3*i+2])}
+}
+
+// compress maps HDR values to [0, 1) so fireflies don't dominate the colour
+// distance.
+func compress(c []float64) [3]float64 {
+	var out [3]float64
+	for i := range out {
+		v := math.Max(c[i], 0)
+		out[i] = v / (1 + v)
+	}
+	return out
+}
+
+func distance2(a, b [3]float64) float64 {
+	dx, dy, dz := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return dx*dx + dy*dy + dz*dz
+}
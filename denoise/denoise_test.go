@@ -0,0 +1,109 @@
+package denoise
+
+import (
+	"github.com/alexa-infra/rayme/imageio"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func fill(w, h int, value func(x, y int) float32) *imageio.FloatImage {
+	img := imageio.MakeFloatImage(w, h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := value(x, y)
+			img.Set(x, y, v, v, v)
+		}
+	}
+	return img
+}
+
+func TestFlatImage(t *testing.T) {
+	img := fill(16, 12, func(x, y int) float32 { return 0.4 })
+	out, err := Denoise(img, Guides{}, MakeOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range out.Pix {
+		if math.Abs(float64(v)-0.4) > 1e-6 {
+			t.Fatalf("flat image changed at %d: %g", i, v)
+		}
+	}
+}
+
+func TestNoiseIsSmoothed(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	img := fill(32, 32, func(x, y int) float32 { return 0.5 + 0.1*float32(rng.NormFloat64()) })
+	out, err := Denoise(img, Guides{}, MakeOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	variance := func(img *imageio.FloatImage) float64 {
+		sum, sum2 := 0.0, 0.0
+		for _, v := range img.Pix {
+			sum += float64(v)
+			sum2 += float64(v) * float64(v)
+		}
+		n := float64(len(img.Pix))
+		return sum2/n - (sum/n)*(sum/n)
+	}
+	if before, after := variance(img), variance(out); after > before/4 {
+		t.Errorf("variance %g before, %g after", before, after)
+	}
+}
+
+func TestEdgeIsPreserved(t *testing.T) {
+	step := func(x, y int) float32 {
+		if x < 8 {
+			return 0.1
+		}
+		return 0.8
+	}
+	img := fill(16, 16, step)
+	normals := imageio.MakeFloatImage(16, 16)
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			if x < 8 {
+				normals.Set(x, y, 0, 1, 0)
+			} else {
+				normals.Set(x, y, 1, 0, 0)
+			}
+		}
+	}
+	out, err := Denoise(img, Guides{Normal: normals}, MakeOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			r, _, _ := out.At(x, y)
+			if d := math.Abs(float64(r - step(x, y))); d > 1e-3 {
+				t.Fatalf("pixel %d,%d: %g, want %g", x, y, r, step(x, y))
+			}
+		}
+	}
+	blurred, err := Denoise(img, Guides{}, MakeOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _, _ := blurred.At(7, 8); math.Abs(float64(r)-0.1) < 1e-3 {
+		t.Errorf("without the normal guide the edge should blur, got %g", r)
+	}
+}
+
+func TestBadOptions(t *testing.T) {
+	img := fill(4, 4, func(x, y int) float32 { return 1 })
+	for _, change := range []func(o *Options){
+		func(o *Options) { o.SigmaColor = 0 },
+		func(o *Options) { o.SigmaNormal = -1 },
+		func(o *Options) { o.SigmaDepth = 0 },
+		func(o *Options) { o.SigmaAlbedo = 0 },
+		func(o *Options) { o.Iterations = -1 },
+	} {
+		opts := MakeOptions()
+		change(&opts)
+		if _, err := Denoise(img, Guides{}, opts); err == nil {
+			t.Errorf("options %+v were accepted", opts)
+		}
+	}
+}
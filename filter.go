@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	. "github.com/alexa-infra/rayme/render"
+)
+
+func makeFilter(name string, radius float64) (Filter, error) {
+	if radius < 0 {
+		return nil, fmt.Errorf("filter radius must not be negative")
+	}
+	withDefault := func(r float64) float64 {
+		if radius == 0 {
+			return r
+		}
+		return radius
+	}
+	switch name {
+	case "box":
+		return MakeBoxFilter(withDefault(0.5)), nil
+	case "tent":
+		return MakeTentFilter(withDefault(1.0)), nil
+	case "gaussian":
+		return MakeGaussianFilter(withDefault(1.5), 2.0), nil
+	case "mitchell":
+		return MakeMitchellFilter(withDefault(2.0), 1.0/3.0, 1.0/3.0), nil
+	case "lanczos":
+		return MakeLanczosFilter(withDefault(3.0), 3.0), nil
+	}
+	return nil, fmt.Errorf("unknown filter %q", name)
+}
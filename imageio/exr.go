@@ -0,0 +1,197 @@
+package imageio
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+type ExrPixelType int
+
+const (
+	ExrHalf  ExrPixelType = 1
+	ExrFloat ExrPixelType = 2
+)
+
+type ExrCompression int
+
+const (
+	ExrNoCompression ExrCompression = 0
+	ExrZip           ExrCompression = 3
+)
+
+type ExrOptions struct {
+	PixelType   ExrPixelType
+	Compression ExrCompression
+	Metadata    Metadata
+}
+
+type ExrChannel struct {
+	Name string
+	Data []float32
+}
+
+func WriteEXR(w io.Writer, img *FloatImage, opts ExrOptions) error {
+	n := img.Width * img.Height
+	r := make([]float32, n)
+	g := make([]float32, n)
+	b := make([]float32, n)
+	for i := 0; i < n; i++ {
+		r[i], g[i], b[i] = img.Pix[3*i], img.Pix[3*i+1], img.Pix[3*i+2]
+	}
+	channels := []ExrChannel{{"R", r}, {"G", g}, {"B", b}}
+	return WriteEXRChannels(w, img.Width, img.Height, channels, opts)
+}
+
+func WriteEXRChannels(w io.Writer, width, height int, channels []ExrChannel, opts ExrOptions) error {
+	if opts.PixelType != ExrHalf && opts.PixelType != ExrFloat {
+		return fmt.Errorf("exr: unsupported pixel type %d", opts.PixelType)
+	}
+	if opts.Compression != ExrNoCompression && opts.Compression != ExrZip {
+		return fmt.Errorf("exr: unsupported compression %d", opts.Compression)
+	}
+	sorted := append([]ExrChannel{}, channels...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	for _, ch := range sorted {
+		if len(ch.Data) != width*height {
+			return fmt.Errorf("exr: channel %s has %d values, expected %d", ch.Name, len(ch.Data), width*height)
+		}
+	}
+
+	header := &bytes.Buffer{}
+	header.Write([]byte{0x76, 0x2f, 0x31, 0x01, 2, 0, 0, 0})
+	chlist := &bytes.Buffer{}
+	for _, ch := range sorted {
+		chlist.WriteString(ch.Name)
+		chlist.WriteByte(0)
+		binary.Write(chlist, binary.LittleEndian, int32(opts.PixelType))
+		chlist.Write([]byte{0, 0, 0, 0})
+		binary.Write(chlist, binary.LittleEndian, [2]int32{1, 1})
+	}
+	chlist.WriteByte(0)
+	writeExrAttribute(header, "channels", "chlist", chlist.Bytes())
+	writeExrAttribute(header, "compression", "compression", []byte{byte(opts.Compression)})
+	window := exrBytes([4]int32{0, 0, int32(width - 1), int32(height - 1)})
+	writeExrAttribute(header, "dataWindow", "box2i", window)
+	writeExrAttribute(header, "displayWindow", "box2i", window)
+	writeExrAttribute(header, "lineOrder", "lineOrder", []byte{0})
+	writeExrAttribute(header, "pixelAspectRatio", "float", exrBytes(float32(1.0)))
+	writeExrAttribute(header, "screenWindowCenter", "v2f", exrBytes([2]float32{0, 0}))
+	writeExrAttribute(header, "screenWindowWidth", "float", exrBytes(float32(1.0)))
+	for _, key := range opts.Metadata.keys() {
+		writeExrAttribute(header, key, "string", []byte(opts.Metadata[key]))
+	}
+	header.WriteByte(0)
+
+	linesPerBlock := 1
+	if opts.Compression == ExrZip {
+		linesPerBlock = 16
+	}
+	blockCount := (height + linesPerBlock - 1) / linesPerBlock
+	blocks := make([][]byte, blockCount)
+	for i := range blocks {
+		y0 := i * linesPerBlock
+		y1 := y0 + linesPerBlock
+		if y1 > height {
+			y1 = height
+		}
+		raw := &bytes.Buffer{}
+		for y := y0; y < y1; y++ {
+			for _, ch := range sorted {
+				row := ch.Data[y*width : (y+1)*width]
+				for _, v := range row {
+					if opts.PixelType == ExrHalf {
+						binary.Write(raw, binary.LittleEndian, floatToHalf(v))
+					} else {
+						binary.Write(raw, binary.LittleEndian, math.Float32bits(v))
+					}
+				}
+			}
+		}
+		data := raw.Bytes()
+		if opts.Compression == ExrZip {
+			compressed, err := zipExrBlock(data)
+			if err != nil {
+				return err
+			}
+			if len(compressed) < len(data) {
+				data = compressed
+			}
+		}
+		blocks[i] = data
+	}
+
+	offset := uint64(header.Len() + 8*blockCount)
+	offsets := make([]uint64, blockCount)
+	for i, data := range blocks {
+		offsets[i] = offset
+		offset += uint64(8 + len(data))
+	}
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, offsets); err != nil {
+		return err
+	}
+	for i, data := range blocks {
+		if err := binary.Write(w, binary.LittleEndian, [2]int32{int32(i * linesPerBlock), int32(len(data))}); err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exrBytes(v interface{}) []byte {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.LittleEndian, v)
+	return buf.Bytes()
+}
+
+func writeExrAttribute(buf *bytes.Buffer, name, kind string, value []byte) {
+	buf.WriteString(name)
+	buf.WriteByte(0)
+	buf.WriteString(kind)
+	buf.WriteByte(0)
+	binary.Write(buf, binary.LittleEndian, int32(len(value)))
+	buf.Write(value)
+}
+
+func zipExrBlock(data []byte) ([]byte, error) {
+	n := len(data)
+	tmp := make([]byte, n)
+	half := (n + 1) / 2
+	for i := 0; i < n; i++ {
+		if i%2 == 0 {
+			tmp[i/2] = data[i]
+		} else {
+			tmp[half+i/2] = data[i]
+		}
+	}
+	prev := 0
+	if n > 0 {
+		prev = int(tmp[0])
+	}
+	for i := 1; i < n; i++ {
+		cur := int(tmp[i])
+		tmp[i] = byte(cur - prev + 128 + 256)
+		prev = cur
+	}
+	out := &bytes.Buffer{}
+	zw := zlib.NewWriter(out)
+	if _, err := zw.Write(tmp); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
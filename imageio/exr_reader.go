@@ -0,0 +1,221 @@
+package imageio
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+)
+
+func ReadEXR(r io.Reader) (*FloatImage, error) {
+	width, height, channels, err := ReadEXRChannels(r)
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string][]float32{}
+	for _, ch := range channels {
+		byName[ch.Name] = ch.Data
+	}
+	red, green, blue := byName["R"], byName["G"], byName["B"]
+	if red == nil {
+		red = byName["Y"]
+	}
+	if red == nil {
+		return nil, fmt.Errorf("exr: no R or Y channel")
+	}
+	if green == nil {
+		green = red
+	}
+	if blue == nil {
+		blue = red
+	}
+	img := MakeFloatImage(width, height)
+	for i := 0; i < width*height; i++ {
+		img.Pix[3*i], img.Pix[3*i+1], img.Pix[3*i+2] = red[i], green[i], blue[i]
+	}
+	return img, nil
+}
+
+type exrChannelInfo struct {
+	name      string
+	pixelType ExrPixelType
+}
+
+func ReadEXRChannels(r io.Reader) (width, height int, channels []ExrChannel, err error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if len(data) < 8 || !bytes.Equal(data[:4], []byte{0x76, 0x2f, 0x31, 0x01}) {
+		return 0, 0, nil, fmt.Errorf("exr: bad magic")
+	}
+	if data[5]&0x1e != 0 {
+		return 0, 0, nil, fmt.Errorf("exr: only single-part scanline images are supported")
+	}
+	pos := 8
+	readString := func() (string, error) {
+		end := bytes.IndexByte(data[pos:], 0)
+		if end < 0 {
+			return "", fmt.Errorf("exr: truncated header")
+		}
+		s := string(data[pos : pos+end])
+		pos += end + 1
+		return s, nil
+	}
+	attrs := map[string][]byte{}
+	for {
+		name, err := readString()
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		if name == "" {
+			break
+		}
+		if _, err := readString(); err != nil {
+			return 0, 0, nil, err
+		}
+		if pos+4 > len(data) {
+			return 0, 0, nil, fmt.Errorf("exr: truncated header")
+		}
+		size := int(binary.LittleEndian.Uint32(data[pos:]))
+		pos += 4
+		if size < 0 || pos+size > len(data) {
+			return 0, 0, nil, fmt.Errorf("exr: truncated attribute %s", name)
+		}
+		attrs[name] = data[pos : pos+size]
+		pos += size
+	}
+
+	chlist, ok := attrs["channels"]
+	if !ok {
+		return 0, 0, nil, fmt.Errorf("exr: missing channels")
+	}
+	infos := []exrChannelInfo{}
+	for p := 0; p < len(chlist) && chlist[p] != 0; {
+		end := bytes.IndexByte(chlist[p:], 0)
+		if end < 0 || p+end+17 > len(chlist) {
+			return 0, 0, nil, fmt.Errorf("exr: bad channel list")
+		}
+		name := string(chlist[p : p+end])
+		p += end + 1
+		pixelType := ExrPixelType(binary.LittleEndian.Uint32(chlist[p:]))
+		if pixelType != ExrHalf && pixelType != ExrFloat {
+			return 0, 0, nil, fmt.Errorf("exr: unsupported pixel type for channel %s", name)
+		}
+		if binary.LittleEndian.Uint32(chlist[p+8:]) != 1 || binary.LittleEndian.Uint32(chlist[p+12:]) != 1 {
+			return 0, 0, nil, fmt.Errorf("exr: subsampled channels are not supported")
+		}
+		p += 16
+		infos = append(infos, exrChannelInfo{name, pixelType})
+	}
+	compression, ok := attrs["compression"]
+	if !ok || len(compression) != 1 {
+		return 0, 0, nil, fmt.Errorf("exr: missing compression")
+	}
+	linesPerBlock := 0
+	switch compression[0] {
+	case 0, 2:
+		linesPerBlock = 1
+	case 3:
+		linesPerBlock = 16
+	default:
+		return 0, 0, nil, fmt.Errorf("exr: unsupported compression %d", compression[0])
+	}
+	window, ok := attrs["dataWindow"]
+	if !ok || len(window) != 16 {
+		return 0, 0, nil, fmt.Errorf("exr: missing dataWindow")
+	}
+	var box [4]int32
+	binary.Read(bytes.NewReader(window), binary.LittleEndian, &box)
+	width = int(box[2] - box[0] + 1)
+	height = int(box[3] - box[1] + 1)
+	if err := checkSize(width, height); err != nil {
+		return 0, 0, nil, fmt.Errorf("exr: bad data window: %v", err)
+	}
+
+	channels = make([]ExrChannel, len(infos))
+	lineBytes := 0
+	for i, info := range infos {
+		channels[i] = ExrChannel{info.name, make([]float32, width*height)}
+		if info.pixelType == ExrHalf {
+			lineBytes += 2 * width
+		} else {
+			lineBytes += 4 * width
+		}
+	}
+	blockCount := (height + linesPerBlock - 1) / linesPerBlock
+	if pos+8*blockCount > len(data) {
+		return 0, 0, nil, fmt.Errorf("exr: truncated offset table")
+	}
+	for b := 0; b < blockCount; b++ {
+		offset := int(binary.LittleEndian.Uint64(data[pos+8*b:]))
+		if offset < 0 || offset+8 > len(data) {
+			return 0, 0, nil, fmt.Errorf("exr: bad block offset")
+		}
+		y := int(int32(binary.LittleEndian.Uint32(data[offset:]))) - int(box[1])
+		size := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		if y < 0 || y >= height || offset+8+size > len(data) {
+			return 0, 0, nil, fmt.Errorf("exr: bad block")
+		}
+		lines := linesPerBlock
+		if y+lines > height {
+			lines = height - y
+		}
+		block := data[offset+8 : offset+8+size]
+		if size < lines*lineBytes {
+			block, err = unzipExrBlock(block, lines*lineBytes)
+			if err != nil {
+				return 0, 0, nil, err
+			}
+		}
+		if len(block) != lines*lineBytes {
+			return 0, 0, nil, fmt.Errorf("exr: bad block size")
+		}
+		q := 0
+		for ly := 0; ly < lines; ly++ {
+			for i, info := range infos {
+				row := channels[i].Data[(y+ly)*width : (y+ly+1)*width]
+				for x := range row {
+					if info.pixelType == ExrHalf {
+						row[x] = halfToFloat(binary.LittleEndian.Uint16(block[q:]))
+						q += 2
+					} else {
+						row[x] = math.Float32frombits(binary.LittleEndian.Uint32(block[q:]))
+						q += 4
+					}
+				}
+			}
+		}
+	}
+	return width, height, channels, nil
+}
+
+func unzipExrBlock(block []byte, expected int) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(block))
+	if err != nil {
+		return nil, fmt.Errorf("exr: %v", err)
+	}
+	tmp, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("exr: %v", err)
+	}
+	if len(tmp) != expected {
+		return nil, fmt.Errorf("exr: bad block size")
+	}
+	for i := 1; i < len(tmp); i++ {
+		tmp[i] = byte(int(tmp[i-1]) + int(tmp[i]) - 128)
+	}
+	out := make([]byte, len(tmp))
+	half := (len(tmp) + 1) / 2
+	for i := range out {
+		if i%2 == 0 {
+			out[i] = tmp[i/2]
+		} else {
+			out[i] = tmp[half+i/2]
+		}
+	}
+	return out, nil
+}
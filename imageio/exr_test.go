@@ -0,0 +1,124 @@
+package imageio
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+// testImage has values above 1, negatives, tiny values and runs of equal
+// pixels, so compression and half rounding are exercised.
+func testImage(width, height int) *FloatImage {
+	img := MakeFloatImage(width, height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < width/3 {
+				img.Set(x, y, 0.5, 0.25, 2)
+				continue
+			}
+			f := float32(x*7+y*13) / 17
+			img.Set(x, y, f, float32(math.Sin(float64(f)))*0.001, f*f/50)
+		}
+	}
+	return img
+}
+
+func TestExrRoundTrip(t *testing.T) {
+	img := testImage(37, 21)
+	for _, compression := range []ExrCompression{ExrNoCompression, ExrZip} {
+		for _, pixelType := range []ExrPixelType{ExrFloat, ExrHalf} {
+			buf := &bytes.Buffer{}
+			opts := ExrOptions{PixelType: pixelType, Compression: compression, Metadata: Metadata{"seed": "1"}}
+			if err := WriteEXR(buf, img, opts); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ReadEXR(buf)
+			if err != nil {
+				t.Fatalf("compression %d type %d: %v", compression, pixelType, err)
+			}
+			if got.Width != img.Width || got.Height != img.Height {
+				t.Fatalf("got %dx%d", got.Width, got.Height)
+			}
+			for i, want := range img.Pix {
+				v := got.Pix[i]
+				if pixelType == ExrFloat && v != want {
+					t.Fatalf("compression %d: value %d is %v, want %v", compression, i, v, want)
+				}
+				if pixelType == ExrHalf && math.Abs(float64(v-want)) > 1e-3*math.Abs(float64(want))+1e-7 {
+					t.Fatalf("compression %d half: value %d is %v, want %v", compression, i, v, want)
+				}
+			}
+		}
+	}
+}
+
+func TestExrChannelsRoundTrip(t *testing.T) {
+	channels := []ExrChannel{
+		{"depth.Y", []float32{1, 2, 3, 4, 5, 6}},
+		{"R", []float32{0, 0.5, 1, 1.5, 2, 2.5}},
+	}
+	buf := &bytes.Buffer{}
+	if err := WriteEXRChannels(buf, 3, 2, channels, ExrOptions{PixelType: ExrFloat, Compression: ExrZip}); err != nil {
+		t.Fatal(err)
+	}
+	width, height, got, err := ReadEXRChannels(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if width != 3 || height != 2 || len(got) != 2 {
+		t.Fatalf("got %dx%d with %d channels", width, height, len(got))
+	}
+	for _, c := range got {
+		want := channels[0]
+		if c.Name == "R" {
+			want = channels[1]
+		} else if c.Name != want.Name {
+			t.Fatalf("unexpected channel %q", c.Name)
+		}
+		for i := range want.Data {
+			if c.Data[i] != want.Data[i] {
+				t.Errorf("%s[%d] is %v, want %v", c.Name, i, c.Data[i], want.Data[i])
+			}
+		}
+	}
+}
+
+func TestHalf(t *testing.T) {
+	tests := []struct {
+		f float32
+		h uint16
+	}{
+		{0, 0x0000},
+		{float32(math.Copysign(0, -1)), 0x8000},
+		{1, 0x3c00},
+		{-2, 0xc000},
+		{0.5, 0x3800},
+		{65504, 0x7bff},
+		{1e6, 0x7c00},
+		{float32(math.Inf(-1)), 0xfc00},
+		{5.960464477539063e-08, 0x0001},
+		{6.103515625e-05, 0x0400},
+	}
+	for _, test := range tests {
+		if h := floatToHalf(test.f); h != test.h {
+			t.Errorf("floatToHalf(%v) = %#04x, want %#04x", test.f, h, test.h)
+		}
+	}
+	for _, test := range tests {
+		if test.f == 1e6 {
+			// overflows to infinity, there is no way back
+			continue
+		}
+		if f := halfToFloat(test.h); f != test.f {
+			t.Errorf("halfToFloat(%#04x) = %v, want %v", test.h, f, test.f)
+		}
+	}
+	if f := halfToFloat(floatToHalf(float32(math.NaN()))); !math.IsNaN(float64(f)) {
+		t.Errorf("NaN became %v", f)
+	}
+	for h := 0; h < 0x7c00; h++ {
+		if back := floatToHalf(halfToFloat(uint16(h))); back != uint16(h) {
+			t.Fatalf("%#04x came back as %#04x", h, back)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package imageio
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ReadImage loads a linear float image, the format is chosen by extension.
+func ReadImage(path string) (*FloatImage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".hdr", ".pic":
+		return ReadHDR(f)
+	case ".pfm":
+		return ReadPFM(f)
+	case ".exr":
+		return ReadEXR(f)
+	}
+	return nil, fmt.Errorf("unsupported image format %q", filepath.Ext(path))
+}
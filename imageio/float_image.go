@@ -0,0 +1,37 @@
+package imageio
+
+import (
+	"fmt"
+)
+
+type FloatImage struct {
+	Width, Height int
+	Pix           []float32
+}
+
+// maxPixels bounds the images the readers accept, a corrupt header must
+// not make them allocate without limit.
+const maxPixels = 1 << 28
+
+// checkSize tells if a width x height image can be read, it also keeps
+// the pixel count from overflowing.
+func checkSize(width, height int) error {
+	if width <= 0 || height <= 0 || width > maxPixels/height {
+		return fmt.Errorf("bad size %dx%d", width, height)
+	}
+	return nil
+}
+
+func MakeFloatImage(width, height int) *FloatImage {
+	return &FloatImage{width, height, make([]float32, 3*width*height)}
+}
+
+func (img *FloatImage) At(x, y int) (r, g, b float32) {
+	i := 3 * (y*img.Width + x)
+	return img.Pix[i], img.Pix[i+1], img.Pix[i+2]
+}
+
+func (img *FloatImage) Set(x, y int, r, g, b float32) {
+	i := 3 * (y*img.Width + x)
+	img.Pix[i], img.Pix[i+1], img.Pix[i+2] = r, g, b
+}
@@ -0,0 +1,209 @@
+package imageio
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+func ReadHDR(r io.Reader) (*FloatImage, error) {
+	br := bufio.NewReader(r)
+	first, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("hdr: %v", err)
+	}
+	if !strings.HasPrefix(first, "#?") {
+		return nil, fmt.Errorf("hdr: bad magic")
+	}
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("hdr: %v", err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(line, "FORMAT=") && line != "FORMAT=32-bit_rle_rgbe" {
+			return nil, fmt.Errorf("hdr: unsupported %s", line)
+		}
+	}
+	var width, height int
+	resolution, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("hdr: %v", err)
+	}
+	if _, err := fmt.Sscanf(resolution, "-Y %d +X %d", &height, &width); err != nil {
+		return nil, fmt.Errorf("hdr: unsupported resolution line %q", strings.TrimSpace(resolution))
+	}
+	if err := checkSize(width, height); err != nil {
+		return nil, fmt.Errorf("hdr: %v", err)
+	}
+	img := MakeFloatImage(width, height)
+	scanline := make([]byte, 4*width)
+	for y := 0; y < height; y++ {
+		if err := readHDRScanline(br, scanline, width); err != nil {
+			return nil, fmt.Errorf("hdr: %v", err)
+		}
+		for x := 0; x < width; x++ {
+			r, g, b := rgbeToFloat(scanline[4*x : 4*x+4])
+			img.Set(x, y, r, g, b)
+		}
+	}
+	return img, nil
+}
+
+func readHDRScanline(br *bufio.Reader, scanline []byte, width int) error {
+	head, err := br.Peek(4)
+	if err != nil {
+		return err
+	}
+	if width < 8 || width > 0x7fff || head[0] != 2 || head[1] != 2 || head[2]&0x80 != 0 {
+		_, err := io.ReadFull(br, scanline)
+		return err
+	}
+	if int(head[2])<<8|int(head[3]) != width {
+		return fmt.Errorf("scanline width mismatch")
+	}
+	br.Discard(4)
+	for ch := 0; ch < 4; ch++ {
+		for x := 0; x < width; {
+			count, err := br.ReadByte()
+			if err != nil {
+				return err
+			}
+			if count > 128 {
+				n := int(count) - 128
+				if x+n > width {
+					return fmt.Errorf("bad run length")
+				}
+				value, err := br.ReadByte()
+				if err != nil {
+					return err
+				}
+				for i := 0; i < n; i++ {
+					scanline[4*(x+i)+ch] = value
+				}
+				x += n
+			} else {
+				n := int(count)
+				if n == 0 || x+n > width {
+					return fmt.Errorf("bad literal length")
+				}
+				for i := 0; i < n; i++ {
+					value, err := br.ReadByte()
+					if err != nil {
+						return err
+					}
+					scanline[4*(x+i)+ch] = value
+				}
+				x += n
+			}
+		}
+	}
+	return nil
+}
+
+func WriteHDR(w io.Writer, img *FloatImage) error {
+	return WriteHDRWithMetadata(w, img, nil)
+}
+
+// WriteHDRWithMetadata stores the metadata as KEY=value header lines.
+func WriteHDRWithMetadata(w io.Writer, img *FloatImage, meta Metadata) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n")
+	for _, key := range meta.keys() {
+		fmt.Fprintf(bw, "%s=%s\n", singleLine(key), singleLine(meta[key]))
+	}
+	fmt.Fprintf(bw, "\n-Y %d +X %d\n", img.Height, img.Width)
+	scanline := make([]byte, 4*img.Width)
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			r, g, b := img.At(x, y)
+			floatToRgbe(scanline[4*x:4*x+4], r, g, b)
+		}
+		if err := writeHDRScanline(bw, scanline, img.Width); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func writeHDRScanline(bw *bufio.Writer, scanline []byte, width int) error {
+	if width < 8 || width > 0x7fff {
+		_, err := bw.Write(scanline)
+		return err
+	}
+	bw.Write([]byte{2, 2, byte(width >> 8), byte(width & 0xff)})
+	channel := make([]byte, width)
+	for ch := 0; ch < 4; ch++ {
+		for x := range channel {
+			channel[x] = scanline[4*x+ch]
+		}
+		writeHDRChannel(bw, channel)
+	}
+	return nil
+}
+
+// writeHDRChannel run-length encodes one component of a scanline: runs of
+// at least minRun equal bytes are stored as (128+n, value), everything
+// else as literal dumps of up to 128 bytes.
+func writeHDRChannel(bw *bufio.Writer, data []byte) {
+	const minRun = 4
+	for x := 0; x < len(data); {
+		run := x
+		runLength := 0
+		for run < len(data) {
+			runLength = 1
+			for run+runLength < len(data) && runLength < 127 && data[run+runLength] == data[run] {
+				runLength++
+			}
+			if runLength >= minRun {
+				break
+			}
+			run += runLength
+			runLength = 0
+		}
+		for x < run {
+			n := run - x
+			if n > 128 {
+				n = 128
+			}
+			bw.WriteByte(byte(n))
+			bw.Write(data[x : x+n])
+			x += n
+		}
+		if runLength >= minRun {
+			bw.WriteByte(byte(128 + runLength))
+			bw.WriteByte(data[run])
+			x += runLength
+		}
+	}
+}
+
+func floatToRgbe(rgbe []byte, r, g, b float32) {
+	v := math.Max(float64(r), math.Max(float64(g), float64(b)))
+	if v < 1e-32 || math.IsNaN(v) {
+		rgbe[0], rgbe[1], rgbe[2], rgbe[3] = 0, 0, 0, 0
+		return
+	}
+	if math.IsInf(v, 1) {
+		v = math.MaxFloat32
+	}
+	m, e := math.Frexp(v)
+	scale := m * 256.0 / v
+	toByte := func(c float32) byte {
+		return byte(math.Min(math.Max(float64(c)*scale, 0), 255))
+	}
+	rgbe[0], rgbe[1], rgbe[2], rgbe[3] = toByte(r), toByte(g), toByte(b), byte(e+128)
+}
+
+func rgbeToFloat(rgbe []byte) (r, g, b float32) {
+	if rgbe[3] == 0 {
+		return 0, 0, 0
+	}
+	f := float32(math.Ldexp(1.0, int(rgbe[3])-(128+8)))
+	return float32(rgbe[0]) * f, float32(rgbe[1]) * f, float32(rgbe[2]) * f
+}
@@ -0,0 +1,91 @@
+package imageio
+
+import (
+	"bufio"
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestHdrRoundTrip(t *testing.T) {
+	// narrow images are stored flat, wider ones run-length encoded, the
+	// widest with runs longer than one RLE packet
+	for _, width := range []int{5, 37, 300} {
+		img := testImage(width, 4)
+		buf := &bytes.Buffer{}
+		if err := WriteHDRWithMetadata(buf, img, Metadata{"samplesPerPixel": "16"}); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), "\nsamplesPerPixel=16\n") {
+			t.Error("metadata is missing from the header")
+		}
+		got, err := ReadHDR(buf)
+		if err != nil {
+			t.Fatalf("width %d: %v", width, err)
+		}
+		if got.Width != img.Width || got.Height != img.Height {
+			t.Fatalf("got %dx%d", got.Width, got.Height)
+		}
+		for i := 0; i < len(img.Pix); i += 3 {
+			// RGBE keeps 8 bits of mantissa relative to the largest component
+			max := math.Max(float64(img.Pix[i]), math.Max(float64(img.Pix[i+1]), float64(img.Pix[i+2])))
+			for c := 0; c < 3; c++ {
+				want := math.Max(float64(img.Pix[i+c]), 0)
+				if d := math.Abs(float64(got.Pix[i+c]) - want); d > max/128 {
+					t.Fatalf("width %d: value %d is %v, want %v", width, i+c, got.Pix[i+c], want)
+				}
+			}
+		}
+	}
+}
+
+func TestHdrRunLength(t *testing.T) {
+	data := []byte{1, 2, 3, 3, 3, 3, 3, 4, 4, 5}
+	for i := 0; i < 200; i++ {
+		data = append(data, 9)
+	}
+	buf := &bytes.Buffer{}
+	bw := bufio.NewWriter(buf)
+	writeHDRChannel(bw, data)
+	bw.Flush()
+	// literal dump of 2, run of 5, literal dump of 3, runs of 127 and 73
+	want := []byte{2, 1, 2, 128 + 5, 3, 3, 4, 4, 5, 128 + 127, 9, 128 + 73, 9}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("encoded as %v, want %v", buf.Bytes(), want)
+	}
+}
+
+func TestPfmRoundTrip(t *testing.T) {
+	img := testImage(13, 7)
+	buf := &bytes.Buffer{}
+	if err := WritePFM(buf, img); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadPFM(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Width != img.Width || got.Height != img.Height {
+		t.Fatalf("got %dx%d", got.Width, got.Height)
+	}
+	for i, want := range img.Pix {
+		if got.Pix[i] != want {
+			t.Fatalf("value %d is %v, want %v", i, got.Pix[i], want)
+		}
+	}
+}
+
+func TestBadSizes(t *testing.T) {
+	for _, size := range []string{"-Y 0 +X 4", "-Y 4 +X -4", "-Y 100000 +X 100000", "-Y 3 +X 9223372036854775807"} {
+		header := "#?RADIANCE\nFORMAT=32-bit_rle_rgbe\n\n" + size + "\n"
+		if _, err := ReadHDR(strings.NewReader(header)); err == nil || !strings.Contains(err.Error(), "bad size") {
+			t.Errorf("hdr %s: %v", size, err)
+		}
+	}
+	for _, size := range []string{"0 4", "4 -1", "100000 100000"} {
+		if _, err := ReadPFM(strings.NewReader("PF\n" + size + "\n-1\n")); err == nil || !strings.Contains(err.Error(), "bad size") {
+			t.Errorf("pfm %s: %v", size, err)
+		}
+	}
+}
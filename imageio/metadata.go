@@ -0,0 +1,24 @@
+package imageio
+
+import (
+	"sort"
+	"strings"
+)
+
+// Metadata is free-form key/value information stored in the header of
+// the formats that support it (EXR, HDR and PNG).
+type Metadata map[string]string
+
+func (this Metadata) keys() []string {
+	keys := make([]string, 0, len(this))
+	for k := range this {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// singleLine keeps values from breaking line based headers.
+func singleLine(s string) string {
+	return strings.NewReplacer("\n", " ", "\r", " ").Replace(s)
+}
@@ -0,0 +1,71 @@
+package imageio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+func ReadPFM(r io.Reader) (*FloatImage, error) {
+	br := bufio.NewReader(r)
+	var magic string
+	var width, height int
+	var scale float64
+	if _, err := fmt.Fscan(br, &magic, &width, &height, &scale); err != nil {
+		return nil, fmt.Errorf("pfm: bad header: %v", err)
+	}
+	channels := 0
+	switch magic {
+	case "PF":
+		channels = 3
+	case "Pf":
+		channels = 1
+	default:
+		return nil, fmt.Errorf("pfm: bad magic %q", magic)
+	}
+	if err := checkSize(width, height); err != nil {
+		return nil, fmt.Errorf("pfm: %v", err)
+	}
+	if _, err := br.ReadByte(); err != nil {
+		return nil, err
+	}
+	var order binary.ByteOrder = binary.BigEndian
+	if scale < 0 {
+		order = binary.LittleEndian
+	}
+	row := make([]byte, 4*channels*width)
+	img := MakeFloatImage(width, height)
+	for y := height - 1; y >= 0; y-- {
+		if _, err := io.ReadFull(br, row); err != nil {
+			return nil, fmt.Errorf("pfm: %v", err)
+		}
+		for x := 0; x < width; x++ {
+			var c [3]float32
+			for ch := 0; ch < channels; ch++ {
+				c[ch] = math.Float32frombits(order.Uint32(row[4*(x*channels+ch):]))
+			}
+			if channels == 1 {
+				c[1], c[2] = c[0], c[0]
+			}
+			img.Set(x, y, c[0], c[1], c[2])
+		}
+	}
+	return img, nil
+}
+
+func WritePFM(w io.Writer, img *FloatImage) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "PF\n%d %d\n-1.0\n", img.Width, img.Height)
+	row := make([]byte, 12*img.Width)
+	for y := img.Height - 1; y >= 0; y-- {
+		for i, v := range img.Pix[3*y*img.Width : 3*(y+1)*img.Width] {
+			binary.LittleEndian.PutUint32(row[4*i:], math.Float32bits(v))
+		}
+		if _, err := bw.Write(row); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
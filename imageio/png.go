@@ -0,0 +1,41 @@
+package imageio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+)
+
+// WritePNG encodes img and stores the metadata as tEXt chunks.
+func WritePNG(w io.Writer, img image.Image, meta Metadata) error {
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+	// signature (8 bytes) and the IHDR chunk (4+4+13+4 bytes) come first
+	const ihdrEnd = 8 + 25
+	if _, err := w.Write(data[:ihdrEnd]); err != nil {
+		return err
+	}
+	for _, key := range meta.keys() {
+		if err := writePNGChunk(w, "tEXt", []byte(key+"\x00"+meta[key])); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(data[ihdrEnd:])
+	return err
+}
+
+func writePNGChunk(w io.Writer, kind string, payload []byte) error {
+	chunk := make([]byte, 8+len(payload)+4)
+	binary.BigEndian.PutUint32(chunk, uint32(len(payload)))
+	copy(chunk[4:], kind)
+	copy(chunk[8:], payload)
+	binary.BigEndian.PutUint32(chunk[8+len(payload):], crc32.ChecksumIEEE(chunk[4:8+len(payload)]))
+	_, err := w.Write(chunk)
+	return err
+}
@@ -0,0 +1,90 @@
+package imageio
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+type ToneOperator int
+
+const (
+	ToneClamp ToneOperator = iota
+	ToneReinhard
+	ToneReinhardExtended
+	ToneHable
+	ToneAces
+)
+
+var toneOperatorNames = map[string]ToneOperator{
+	"clamp":             ToneClamp,
+	"reinhard":          ToneReinhard,
+	"reinhard-extended": ToneReinhardExtended,
+	"hable":             ToneHable,
+	"aces":              ToneAces,
+}
+
+func ParseToneOperator(name string) (ToneOperator, error) {
+	if op, ok := toneOperatorNames[name]; ok {
+		return op, nil
+	}
+	return ToneClamp, fmt.Errorf("unknown tone mapping operator %q", name)
+}
+
+// DisplayTransform maps linear scene radiance to sRGB encoded display
+// values: exposure (in stops), then the tone curve, then the sRGB OETF.
+// White is the linear value mapped to 1.0 by Reinhard-extended and Hable.
+type DisplayTransform struct {
+	Exposure float64
+	Operator ToneOperator
+	White    float64
+}
+
+func MakeDisplayTransform() DisplayTransform {
+	return DisplayTransform{0, ToneClamp, 4.0}
+}
+
+func hable(x float64) float64 {
+	const a, b, c, d, e, f = 0.15, 0.50, 0.10, 0.20, 0.02, 0.30
+	return (x*(a*x+c*b)+d*e)/(x*(a*x+b)+d*f) - e/f
+}
+
+func (t DisplayTransform) curve(x float64) float64 {
+	switch t.Operator {
+	case ToneReinhard:
+		return x / (1.0 + x)
+	case ToneReinhardExtended:
+		return x * (1.0 + x/(t.White*t.White)) / (1.0 + x)
+	case ToneHable:
+		return hable(2.0*x) / hable(t.White)
+	case ToneAces:
+		x *= 0.6
+		return (x * (2.51*x + 0.03)) / (x*(2.43*x+0.59) + 0.14)
+	}
+	return x
+}
+
+func (t DisplayTransform) Apply(v float64) float64 {
+	if math.IsNaN(v) || v <= 0 {
+		return 0
+	}
+	v = t.curve(v * math.Exp2(t.Exposure))
+	return LinearToSrgb(math.Min(math.Max(v, 0), 1))
+}
+
+func (t DisplayTransform) ToImage(img *FloatImage) *image.RGBA64 {
+	out := image.NewRGBA64(image.Rect(0, 0, img.Width, img.Height))
+	for y := 0; y < img.Height; y++ {
+		for x := 0; x < img.Width; x++ {
+			r, g, b := img.At(x, y)
+			out.SetRGBA64(x, y, color.RGBA64{
+				uint16(math.Round(0xffff * t.Apply(float64(r)))),
+				uint16(math.Round(0xffff * t.Apply(float64(g)))),
+				uint16(math.Round(0xffff * t.Apply(float64(b)))),
+				0xffff,
+			})
+		}
+	}
+	return out
+}
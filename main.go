@@ -3,14 +3,16 @@ package main
 import (
 	"flag"
 	"fmt"
+	"github.com/alexa-infra/rayme/denoise"
+	"github.com/alexa-infra/rayme/imageio"
 	. "github.com/alexa-infra/rayme/math"
 	. "github.com/alexa-infra/rayme/render"
-	"image"
-	"image/png"
+	"github.com/alexa-infra/rayme/scene"
 	"log"
-	"math"
 	"os"
-	"sync"
+	"os/signal"
+	"runtime"
+	"strings"
 	"time"
 )
 
@@ -23,8 +25,47 @@ const (
 
 var (
 	sceneID                  = flag.Int("scene", 0, "Scene ID")
+	sceneFile                = flag.String("scene-file", "", "Scene description file (JSON), overrides -scene")
+	outputPath               = flag.String("o", "output.png", "Output image, format is chosen by extension (.png, .exr, .hdr, .pfm)")
+	exrPixelType             = flag.String("exr-type", "float", "EXR channel type: half or float")
+	exrCompression           = flag.String("exr-compression", "zip", "EXR compression: none or zip")
+	exposure                 = flag.Float64("exposure", 0, "Exposure adjustment in stops, applied before tone mapping")
+	toneOperator             = flag.String("tonemap", "clamp", "Tone mapping: clamp, reinhard, reinhard-extended, hable or aces")
+	whitePoint               = flag.Float64("white", 4.0, "White point for reinhard-extended and hable")
+	aovSpec                  = flag.String("aov", "", "Comma separated AOV passes (depth, normal, position, albedo, uv, material, object, emission, diffuseDirect, diffuseIndirect, specularDirect, specularIndirect, transmission), all or light")
+	denoiseOutput            = flag.Bool("denoise", false, "Denoise the image guided by albedo, normal and depth passes")
+	denoiseIters             = flag.Int("denoise-iterations", denoise.MakeOptions().Iterations, "Number of denoiser filter iterations")
+	denoiseSigma             = flag.Float64("denoise-sigma", denoise.MakeOptions().SigmaColor, "Denoiser colour edge sensitivity, larger values smooth more")
+	adaptiveError            = flag.Float64("adaptive", 0, "Keep sampling pixels whose relative error exceeds this threshold, 0 disables")
+	maxSpp                   = flag.Int("max-spp", 0, "Sample budget per pixel for adaptive sampling, defaults to 4x the base count")
+	heatmapPath              = flag.String("heatmap", "", "Write a per-pixel sample count heatmap to this file")
+	filterName               = flag.String("filter", "box", "Pixel reconstruction filter: box, tent, gaussian, mitchell or lanczos")
+	filterRadius             = flag.Float64("filter-radius", 0, "Filter radius in pixels, 0 uses the filter's default")
+	tileSize                 = flag.Int("tile-size", 32, "Tile size in pixels")
+	tileOrder                = flag.String("tile-order", "spiral", "Tile order: scanline, spiral (from the centre) or hilbert")
+	workers                  = flag.Int("workers", runtime.GOMAXPROCS(0), "Number of render workers")
+	renderSeed               = flag.Int64("seed", 1, "Sampling seed, renders with different seeds can be merged")
+	passCount                = flag.Int("passes", 1, "Number of full-frame sample passes, each adds the base samples per pixel")
+	checkpointPath           = flag.String("checkpoint", "", "Save the accumulation state to this file after passes and on interrupt")
+	checkpointEvery          = flag.Duration("checkpoint-interval", time.Minute, "Minimum time between checkpoints")
+	resumePath               = flag.String("resume", "", "Continue a render from a checkpoint file")
+	timeLimit                = flag.Duration("time-limit", 0, "Keep adding passes until this much time has passed, overrides -passes")
+	remoteWorkers            = flag.String("remote", "", "Comma separated worker URLs, passes are rendered remotely and merged")
+	jobPasses                = flag.Int("job-passes", 1, "Number of passes per remote job")
+	listenAddr               = flag.String("listen", ":8080", "Address the worker or server listens on")
+	maxJobs                  = flag.Int("max-jobs", 1, "Number of jobs the server renders at once")
+	queueSize                = flag.Int("queue-size", 16, "Number of jobs the server keeps waiting, more are refused")
+	jobsDir                  = flag.String("jobs-dir", "", "Directory for server job results, a temporary one by default")
+	keepJobs                 = flag.Int("keep-jobs", 100, "Number of finished jobs the server keeps, older ones are removed with their results")
+	maxJobSize               = flag.Int("max-job-size", 4096, "Largest width or height of a posted render")
+	maxJobSamples            = flag.Int("max-job-samples", 1024, "Largest number of samples per pixel and pass of a posted render")
+	maxJobPasses             = flag.Int("max-job-passes", 256, "Largest number of passes of a posted render")
+	maxRequestSize           = flag.Int64("max-request-size", 8<<20, "Largest posted job in bytes")
+	sceneRoot                = flag.String("scene-root", "", "Directory with the files posted scenes may use, relative paths only; without it they may use none")
 	lookFrom        *Point3  = nil
 	lookAt          *Point3  = nil
+	vup                      = &Vec3{0, 1, 0}
+	focusDist                = float64(distToFocus)
 	vfov                     = 20.0
 	aperture                 = 0.0
 	world           Hittable = nil
@@ -37,10 +78,170 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		var command func([]string) error
+		switch os.Args[1] {
+		case "compare":
+			command = compareCommand
+		case "tonemap":
+			command = tonemapCommand
+		case "denoise":
+			command = denoiseCommand
+		case "worker":
+			command = workerCommand
+		case "merge":
+			command = mergeCommand
+		case "serve":
+			command = serveCommand
+		case "view":
+			command = viewCommand
+		}
+		if command != nil {
+			if err := command(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
 	flag.Parse()
+	if *denoiseOutput {
+		if err := denoiseOptions().Check(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := loadScene(); err != nil {
+		log.Fatal(err)
+	}
+	startFull := time.Now()
+	f, err := setupFrame()
+	if err != nil {
+		log.Fatal(err)
+	}
+	r, err := f.newRenderer(*renderSeed)
+	if err != nil {
+		log.Fatal(err)
+	}
+	maxSamples := *maxSpp
+	if maxSamples <= 0 {
+		maxSamples = 4 * len(f.samples)
+	}
+	if *resumePath != "" {
+		c, err := loadCheckpoint(*resumePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := r.restore(c); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Resuming after %d passes\n", r.pass)
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		signal.Stop(interrupt)
+		fmt.Fprintln(os.Stderr, "\nInterrupted, finishing tiles in flight")
+		r.cancel()
+	}()
+	if *timeLimit > 0 {
+		timer := time.AfterFunc(*timeLimit-time.Since(startFull), func() {
+			fmt.Fprintln(os.Stderr, "\nTime limit reached, finishing tiles in flight")
+			r.cancel()
+		})
+		defer timer.Stop()
+	}
+	lastCheckpoint := time.Now()
+	if *remoteWorkers != "" {
+		if *adaptiveError > 0 || *checkpointPath != "" || *resumePath != "" {
+			log.Fatal("-remote does not support -adaptive, -checkpoint or -resume")
+		}
+		lastPass := *passCount
+		if *timeLimit > 0 {
+			lastPass = -1
+		}
+		if err := renderRemote(r, strings.Split(*remoteWorkers, ","), lastPass, *jobPasses); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for *remoteWorkers == "" && !r.isCancelled() {
+		label := fmt.Sprintf("Pass %d/%d", r.pass+1, *passCount)
+		count := len(f.samples)
+		needed := func(p *pixelStats) bool { return true }
+		if *timeLimit > 0 {
+			label = fmt.Sprintf("Pass %d", r.pass+1)
+		} else if r.pass >= *passCount {
+			if *adaptiveError <= 0 {
+				break
+			}
+			label = fmt.Sprintf("Adaptive pass %d", r.pass-*passCount+1)
+			count = adaptiveBatch
+			needed = func(p *pixelStats) bool {
+				return !p.converged(*adaptiveError, maxSamples)
+			}
+		}
+		if r.renderPass(label, count, needed) == 0 {
+			break
+		}
+		if *checkpointPath != "" && time.Since(lastCheckpoint) >= *checkpointEvery {
+			if err := saveCheckpoint(*checkpointPath, r.checkpoint()); err != nil {
+				log.Fatal(err)
+			}
+			lastCheckpoint = time.Now()
+		}
+	}
+	if err := r.failure(); err != nil {
+		log.Fatal(err)
+	}
+	if *checkpointPath != "" {
+		if err := saveCheckpoint(*checkpointPath, r.checkpoint()); err != nil {
+			log.Fatal(err)
+		}
+	}
+	renderTime := time.Since(startFull)
+	fmt.Printf("\nFull time: %9.2f seconds\n", renderTime.Seconds())
+	fmt.Printf("Samples per pixel: %.2f\n", r.samplesPerPixel())
+	meta := imageio.Metadata{
+		"samplesPerPixel": fmt.Sprintf("%.2f", r.samplesPerPixel()),
+		"passes":          fmt.Sprint(r.pass),
+		"renderTime":      fmt.Sprintf("%.2fs", renderTime.Seconds()),
+		"seed":            fmt.Sprint(r.seed),
+	}
+	myImg := r.film.Image()
+	if *denoiseOutput {
+		if myImg, err = denoise.Denoise(myImg, denoiseGuides(r.passes), denoiseOptions()); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := writeRender(*outputPath, myImg, r.passes, meta); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if *heatmapPath != "" {
+		if err := writeOutput(*heatmapPath, sampleHeatmap(r.stats, f.width, f.height, maxSamples)); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+}
+
+// loadScene sets up the world, lights and camera settings from the scene
+// file or the built-in scene selected by the flags.
+func loadScene() error {
 	rng = MakeRandExt(seed)
 
-	if *sceneID == 0 {
+	if *sceneFile != "" {
+		sc, err := scene.Load(*sceneFile)
+		if err != nil {
+			return err
+		}
+		world, lights = sc.World, sc.Lights
+		lookFrom, lookAt, vup = sc.LookFrom, sc.LookAt, sc.Vup
+		vfov, aperture, focusDist = sc.Vfov, sc.Aperture, sc.FocusDist
+		aspectRatio = sc.AspectRatio
+		bgColor = sc.Background
+		imageWidth = sc.ImageWidth
+		samplesPerPixel = sc.SamplesPerPixel
+	} else if *sceneID == 0 {
 		world = randomScene()
 		lookFrom = MakePoint3(13, 2, 3)
 		lookAt = MakePoint3(0, 0, 0)
@@ -91,70 +292,55 @@ func main() {
 		aspectRatio = 1.0
 		imageWidth = 500
 		bgColor = &Vec3{0.0, 0.0, 0.0}
+	} else if *sceneID == 6 {
+		world, lights = materialsDemo()
+		lookFrom = MakePoint3(0, 3, 12)
+		lookAt = MakePoint3(0, 1, 0)
+		vfov = 30.0
+		aperture = 0.0
+		imageWidth = 640
+		samplesPerPixel = 64
+		bgColor = &Vec3{0.1, 0.1, 0.1}
+	} else if *sceneID == 7 {
+		world, lights = mixDemo()
+		lookFrom = MakePoint3(0, 3, 12)
+		lookAt = MakePoint3(0, 1, 0)
+		vfov = 30.0
+		aperture = 0.0
+		imageWidth = 640
+		samplesPerPixel = 64
+		bgColor = &Vec3{0.1, 0.1, 0.1}
+	} else if *sceneID == 8 {
+		world, lights = bumpDemo()
+		lookFrom = MakePoint3(0, 3, 12)
+		lookAt = MakePoint3(0, 1, 0)
+		vfov = 30.0
+		aperture = 0.0
+		imageWidth = 640
+		samplesPerPixel = 16
+		bgColor = &Vec3{0.1, 0.1, 0.1}
+	} else if *sceneID == 9 {
+		world, lights = cutoutDemo()
+		lookFrom = MakePoint3(0, 3, 12)
+		lookAt = MakePoint3(0, 1, 0)
+		vfov = 30.0
+		aperture = 0.0
+		imageWidth = 640
+		samplesPerPixel = 16
+		bgColor = &Vec3{0.1, 0.1, 0.1}
+	} else if *sceneID == 10 {
+		world, lights = proceduralDemo()
+		lookFrom = MakePoint3(0, 4, 14)
+		lookAt = MakePoint3(0, 1, 0)
+		vfov = 30.0
+		aperture = 0.0
+		imageWidth = 640
+		samplesPerPixel = 16
+		bgColor = &Vec3{0.1, 0.1, 0.1}
 	} else {
-		fmt.Println("unknown sceneID")
-		os.Exit(1)
-	}
-	samples := []*Vec3{&Vec3{0.0, 0.0, 0.0}}
-	for i := 0; i < samplesPerPixel; i++ {
-		samples = append(samples, rng.RandomInUnitDisk())
-	}
-	camera := MakeCamera(lookFrom, lookAt, &Vec3{0, 1, 0}, vfov, aspectRatio, aperture, distToFocus, 0.0, 1.0)
-
-	startFull := time.Now()
-
-	imageHeight := int(float64(imageWidth) / aspectRatio)
-	myImg := image.NewRGBA64(image.Rect(0, 0, imageWidth, imageHeight))
-	scale := 1.0 / float64(len(samples))
-	zero := Vec3{0, 0, 0}
-	type Pixel struct {
-		x, y int
-	}
-	in := make(chan Pixel)
-	var wg sync.WaitGroup
-	renderPixel := func(workerId int) {
-		rng1 := MakeRandExt(seed + workerId + 1)
-		for {
-			p, ok := <-in
-			if !ok {
-				break
-			}
-			sumColor := &zero
-			for _, s := range samples {
-				u := (float64(p.x) + s.X) / float64(imageWidth-1)
-				v := (float64(p.y) + s.Y) / float64(imageHeight-1)
-				ray := camera.CastRay(u, v, rng1)
-				rayColor := GetRayColor(ray, bgColor, world, lights, maxDepth, rng1)
-				sumColor = sumColor.Add(rayColor)
-			}
-			sumColor = &Vec3{
-				math.Sqrt(sumColor.X * scale),
-				math.Sqrt(sumColor.Y * scale),
-				math.Sqrt(sumColor.Z * scale),
-			}
-			myImg.Set(p.x, imageHeight-p.y-1, sumColor.AsColor())
-		}
-		wg.Done()
+		return fmt.Errorf("unknown sceneID")
 	}
-	for i := 0; i < 4; i++ {
-		wg.Add(1)
-		go renderPixel(i)
-	}
-	for j := 0; j < imageHeight; j++ {
-		for i := 0; i < imageWidth; i++ {
-			in <- Pixel{i, j}
-		}
-	}
-	close(in)
-	wg.Wait()
-	fmt.Printf("\nFull time: %9.2f seconds\n", time.Since(startFull).Seconds())
-	outImage, err := os.Create("output.png")
-	if err != nil {
-		fmt.Println("can't open file to write")
-		os.Exit(1)
-	}
-	png.Encode(outImage, myImg)
-	outImage.Close()
+	return nil
 }
 
 func randomScene() Hittable {
@@ -230,7 +416,7 @@ func twoSpheresScene() (world, light Hittable) {
 }
 
 func earthSphereScene() Hittable {
-	tex, err := MakeImageTexture("./earthmap.jpg")
+	tex, err := MakeFilteredImageTexture("./earthmap.jpg", WrapRepeat, FilterAnisotropic)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -317,3 +503,125 @@ func meshDemo() (world, lights Hittable) {
 	}
 	return
 }
+
+func materialsDemo() (world, lights Hittable) {
+	checker := MakeCheckerTexture3d(1.0, &Vec3{0.2, 0.3, 0.1}, &Vec3{0.9, 0.9, 0.9})
+	ground := MakeLambertianTexture(checker)
+	clay := MakeOrenNayarSolidColor(&Vec3{0.8, 0.5, 0.3}, 30)
+	lambert := MakeLambertianSolidColor(&Vec3{0.8, 0.5, 0.3})
+	coated := MakeCoatedDiffuseSolidColor(&Vec3{0.7, 0.1, 0.1}, 1.5, 0.0)
+	difflight := MakeDiffuseLightFromColor(&Vec3{4, 4, 4})
+	lights = MakeRectXZ(-5, -5, 5, 5, 10, nil)
+	world = &HittableList{
+		[]Hittable{
+			&Sphere{MakePoint3(0.0, -1000, 0.0), 1000.0, ground},
+			&Sphere{MakePoint3(-2.5, 1, 0.0), 1.0, clay},
+			&Sphere{MakePoint3(0.0, 1, 0.0), 1.0, lambert},
+			&Sphere{MakePoint3(2.5, 1, 0.0), 1.0, coated},
+			MakeFlipFace(MakeRectXZ(-5, -5, 5, 5, 10, difflight)),
+		},
+	}
+	return
+}
+
+func mixDemo() (world, lights Hittable) {
+	white := &Vec3{1, 1, 1}
+	black := &Vec3{0, 0, 0}
+	floorMask := MakeCheckerTexture3d(1.0, white, black)
+	floor := MakeMix(MakeLambertianSolidColor(&Vec3{0.8, 0.8, 0.8}), MakeMetal(&Vec3{0.7, 0.7, 0.7}, 0.05), floorMask)
+	rust := MakeLambertianSolidColor(&Vec3{0.45, 0.2, 0.08})
+	steel := MakeMetal(&Vec3{0.8, 0.8, 0.85}, 0.1)
+	rusty := MakeMix(steel, rust, MakeNoiseTexture(3.0, rng))
+	paint := MakeCoatedDiffuseSolidColor(&Vec3{0.1, 0.2, 0.7}, 1.5, 0.0)
+	dirt := MakeOrenNayarSolidColor(&Vec3{0.3, 0.25, 0.2}, 40)
+	dirty := MakeMix(paint, dirt, MakeNoiseTexture(1.5, rng))
+	difflight := MakeDiffuseLightFromColor(&Vec3{4, 4, 4})
+	lights = MakeRectXZ(-5, -5, 5, 5, 10, nil)
+	world = &HittableList{
+		[]Hittable{
+			&Sphere{MakePoint3(0.0, -1000, 0.0), 1000.0, floor},
+			&Sphere{MakePoint3(-1.5, 1, 0.0), 1.0, rusty},
+			&Sphere{MakePoint3(1.5, 1, 0.0), 1.0, dirty},
+			MakeFlipFace(MakeRectXZ(-5, -5, 5, 5, 10, difflight)),
+		},
+	}
+	return
+}
+
+func bumpDemo() (world, lights Hittable) {
+	floor := MakeBumpMap(MakeLambertianSolidColor(&Vec3{0.6, 0.6, 0.6}), MakeNoiseTexture(2.0, rng), 0.05)
+	stone := MakeBumpMap(MakeOrenNayarSolidColor(&Vec3{0.7, 0.6, 0.5}, 20), MakeNoiseTexture(4.0, rng), 0.1)
+	gold := MakeBumpMap(MakeMetal(&Vec3{0.9, 0.7, 0.3}, 0.0), MakeNoiseTexture(3.0, rng), 0.02)
+	mesh := MakeSphereMesh(MakeBumpMap(MakeLambertianSolidColor(&Vec3{0.2, 0.4, 0.8}), MakeNoiseTexture(6.0, rng), 0.05), 1, 30, rng)
+	difflight := MakeDiffuseLightFromColor(&Vec3{4, 4, 4})
+	lights = MakeRectXZ(-5, -5, 5, 5, 10, nil)
+	world = &HittableList{
+		[]Hittable{
+			MakeRectXZ(-20, -20, 20, 20, 0, floor),
+			&Sphere{MakePoint3(-2.5, 1, 0.0), 1.0, stone},
+			&Sphere{MakePoint3(0.0, 1, 0.0), 1.0, gold},
+			MakeTranslate(MakeRotateY(mesh, 30), &Vec3{2.5, 1, 0}),
+			MakeFlipFace(MakeRectXZ(-5, -5, 5, 5, 10, difflight)),
+		},
+	}
+	return
+}
+
+func cutoutDemo() (world, lights Hittable) {
+	white := &Vec3{1, 1, 1}
+	black := &Vec3{0, 0, 0}
+	ground := MakeLambertianSolidColor(&Vec3{0.6, 0.6, 0.6})
+	wood := MakeLambertianSolidColor(&Vec3{0.5, 0.3, 0.15})
+	fence := MakeCutout(MakeRectXY(-4, 0, 4, 2, 2, wood), MakeCheckerTexture2d(16, white, black), 0.5)
+	leaves := MakeStochasticCutout(&Sphere{MakePoint3(0.0, 1, -1), 1.0, MakeLambertianSolidColor(&Vec3{0.2, 0.6, 0.2})}, MakeNoiseTexture(4.0, rng))
+	difflight := MakeDiffuseLightFromColor(&Vec3{4, 4, 4})
+	lights = MakeRectXZ(-5, -5, 5, 5, 10, nil)
+	world = &HittableList{
+		[]Hittable{
+			MakeRectXZ(-20, -20, 20, 20, 0, ground),
+			fence,
+			leaves,
+			MakeFlipFace(MakeRectXZ(-5, -5, 5, 5, 10, difflight)),
+		},
+	}
+	return
+}
+
+func proceduralDemo() (world, lights Hittable) {
+	marbleRamp := MakeColorRamp(
+		ColorStop{0.0, &Vec3{0.15, 0.15, 0.2}},
+		ColorStop{0.4, &Vec3{0.8, 0.8, 0.8}},
+		ColorStop{1.0, &Vec3{0.95, 0.95, 0.9}},
+	)
+	woodRamp := MakeColorRamp(
+		ColorStop{0.0, &Vec3{0.45, 0.25, 0.1}},
+		ColorStop{0.7, &Vec3{0.6, 0.38, 0.18}},
+		ColorStop{1.0, &Vec3{0.3, 0.15, 0.05}},
+	)
+	cellRamp := MakeColorRamp(
+		ColorStop{0.0, &Vec3{0.05, 0.05, 0.05}},
+		ColorStop{0.1, &Vec3{0.7, 0.5, 0.2}},
+	)
+	rockRamp := MakeColorRamp(
+		ColorStop{0.0, &Vec3{0.2, 0.2, 0.25}},
+		ColorStop{1.0, &Vec3{0.8, 0.75, 0.7}},
+	)
+	floor := MakeLambertianTexture(MakeWoodTexture(0.5, 4.0, 2.0, woodRamp, rng))
+	marble := MakeCoatedDiffuse(MakeMarbleTexture(2.0, 6.0, marbleRamp, rng), 1.5, 0.0)
+	cells := MakeLambertianTexture(MakeVoronoiTexture(3.0, VoronoiEdges, cellRamp, rng))
+	clouds := MakeLambertianTexture(MakeFbmTexture(2.0, 6, 2.0, 0.5, MakeGrayRamp(), rng))
+	rock := MakeLambertianTexture(MakeRidgedTexture(1.5, 6, 2.0, 2.0, 1.0, rockRamp, rng))
+	difflight := MakeDiffuseLightFromColor(&Vec3{4, 4, 4})
+	lights = MakeRectXZ(-5, -5, 5, 5, 10, nil)
+	world = &HittableList{
+		[]Hittable{
+			MakeRectXZ(-20, -20, 20, 20, 0, floor),
+			&Sphere{MakePoint3(-3.3, 1, 0.0), 1.0, marble},
+			&Sphere{MakePoint3(-1.1, 1, 0.0), 1.0, cells},
+			&Sphere{MakePoint3(1.1, 1, 0.0), 1.0, clouds},
+			&Sphere{MakePoint3(3.3, 1, 0.0), 1.0, rock},
+			MakeFlipFace(MakeRectXZ(-5, -5, 5, 5, 10, difflight)),
+		},
+	}
+	return
+}
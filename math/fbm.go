@@ -0,0 +1,45 @@
+package math
+
+func Fbm(noise func(x, y, z float64) float64, x, y, z float64, octaves int, lacunarity, gain float64) float64 {
+	acc := 0.0
+	amplitude := 1.0
+	for i := 0; i < octaves; i++ {
+		acc += amplitude * noise(x, y, z)
+		amplitude *= gain
+		x *= lacunarity
+		y *= lacunarity
+		z *= lacunarity
+	}
+	return acc
+}
+
+func Fbm4(noise func(x, y, z, w float64) float64, x, y, z, w float64, octaves int, lacunarity, gain float64) float64 {
+	acc := 0.0
+	amplitude := 1.0
+	for i := 0; i < octaves; i++ {
+		acc += amplitude * noise(x, y, z, w)
+		amplitude *= gain
+		x *= lacunarity
+		y *= lacunarity
+		z *= lacunarity
+		w *= lacunarity
+	}
+	return acc
+}
+
+func Ridged(noise func(x, y, z float64) float64, x, y, z float64, octaves int, lacunarity, gain, offset float64) float64 {
+	acc := 0.0
+	amplitude := 0.5
+	weight := 1.0
+	for i := 0; i < octaves; i++ {
+		signal := offset - Abs(noise(x, y, z))
+		signal *= signal * weight
+		weight = Clamp(signal*gain, 0.0, 1.0)
+		acc += signal * amplitude
+		amplitude *= 0.5
+		x *= lacunarity
+		y *= lacunarity
+		z *= lacunarity
+	}
+	return acc
+}
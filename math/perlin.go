@@ -24,35 +24,32 @@ func MakePerlin(rng *RandExt) *Perlin {
 }
 
 func (this *Perlin) Noise(p *Point3) float64 {
-	u := p.X - math.Floor(p.X)
-	v := p.Y - math.Floor(p.Y)
-	w := p.Z - math.Floor(p.Z)
-	i := int(math.Floor(p.X))
-	j := int(math.Floor(p.Y))
-	k := int(math.Floor(p.Z))
-	c := make([][][]*Vec3, 2)
-	for di := 0; di < 2; di++ {
-		c[di] = make([][]*Vec3, 2)
-		for dj := 0; dj < 2; dj++ {
-			c[di][dj] = make([]*Vec3, 2)
-			for dk := 0; dk < 2; dk++ {
-				c[di][dj][dk] = this.randVec[this.permX[(i+di)&mask]^this.permY[(j+dj)&mask]^this.permZ[(k+dk)&mask]]
-			}
-		}
-	}
-	return trilinearInterp(c, u, v, w)
+	return this.Noise3(p.X, p.Y, p.Z)
 }
 
-func trilinearInterp(c [][][]*Vec3, u, v, w float64) float64 {
-	u = u * u * (3 - 2*u)
-	v = v * v * (3 - 2*v)
-	w = w * w * (3 - 2*w)
+func (this *Perlin) Noise3(x, y, z float64) float64 {
+	fx := math.Floor(x)
+	fy := math.Floor(y)
+	fz := math.Floor(z)
+	u := x - fx
+	v := y - fy
+	w := z - fz
+	i := int(fx)
+	j := int(fy)
+	k := int(fz)
+	uu := u * u * (3 - 2*u)
+	vv := v * v * (3 - 2*v)
+	ww := w * w * (3 - 2*w)
 	acc := 0.0
-	for i := 0; i < 2; i++ {
-		for j := 0; j < 2; j++ {
-			for k := 0; k < 2; k++ {
-				weight := &Vec3{u - float64(i), v - float64(j), w - float64(k)}
-				acc += (float64(i)*u + (1.0-float64(i))*(1-u)) * (float64(j)*v + (1.0-float64(j))*(1-v)) * (float64(k)*w + (1.0-float64(k))*(1-w)) * Dot(c[i][j][k], weight)
+	for di := 0; di < 2; di++ {
+		wi := float64(di)*uu + (1.0-float64(di))*(1-uu)
+		for dj := 0; dj < 2; dj++ {
+			wj := float64(dj)*vv + (1.0-float64(dj))*(1-vv)
+			for dk := 0; dk < 2; dk++ {
+				wk := float64(dk)*ww + (1.0-float64(dk))*(1-ww)
+				c := this.randVec[this.permX[(i+di)&mask]^this.permY[(j+dj)&mask]^this.permZ[(k+dk)&mask]]
+				dot := c.X*(uu-float64(di)) + c.Y*(vv-float64(dj)) + c.Z*(ww-float64(dk))
+				acc += wi * wj * wk * dot
 			}
 		}
 	}
@@ -60,12 +57,13 @@ func trilinearInterp(c [][][]*Vec3, u, v, w float64) float64 {
 }
 
 func (this *Perlin) Turb(p *Point3, depth int) float64 {
-	acc := 0.0
-	weight := 1.0
-	for i := 0; i < depth; i++ {
-		acc += weight * this.Noise(p)
-		weight *= 0.5
-		p = p.Mul(2.0).AsPoint3()
-	}
-	return Abs(acc)
+	return Abs(this.Fbm(p, depth, 2.0, 0.5))
+}
+
+func (this *Perlin) Fbm(p *Point3, octaves int, lacunarity, gain float64) float64 {
+	return Fbm(this.Noise3, p.X, p.Y, p.Z, octaves, lacunarity, gain)
+}
+
+func (this *Perlin) Ridged(p *Point3, octaves int, lacunarity, gain, offset float64) float64 {
+	return Ridged(this.Noise3, p.X, p.Y, p.Z, octaves, lacunarity, gain, offset)
 }
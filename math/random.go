@@ -14,6 +14,12 @@ func MakeRandExt(seed int) *RandExt {
 	return &RandExt{randGen}
 }
 
+// MakeSeededRandExt starts a generator from seed. MakeRandExt always
+// starts from the same state, the built-in scenes are laid out with it.
+func MakeSeededRandExt(seed int64) *RandExt {
+	return &RandExt{rand.New(rand.NewSource(seed))}
+}
+
 func (this *RandExt) Between(a, b float64) float64 {
 	return this.Rand.Float64()*(b-a) + a
 }
@@ -4,15 +4,17 @@ type Ray struct {
 	Origin    *Point3
 	Direction *Vec3
 	Time      float64
+	Spread    float64
+	Sample    float64 // uniform random number for stochastic tests along the ray
 }
 
 func MakeRayFromPoints(origin, target *Point3, time float64) *Ray {
 	dir := GetDirection(origin, target).Normalize()
-	return &Ray{origin, dir, time}
+	return &Ray{origin, dir, time, 0.0, 0.0}
 }
 
 func MakeRayFromDirection(origin *Point3, dir *Vec3, time float64) *Ray {
-	return &Ray{origin, dir.Normalize(), time}
+	return &Ray{origin, dir.Normalize(), time, 0.0, 0.0}
 }
 
 func (r *Ray) At(t float64) *Point3 {
@@ -0,0 +1,207 @@
+package math
+
+import "math"
+
+var grad3 = [12][3]float64{
+	{1, 1, 0}, {-1, 1, 0}, {1, -1, 0}, {-1, -1, 0},
+	{1, 0, 1}, {-1, 0, 1}, {1, 0, -1}, {-1, 0, -1},
+	{0, 1, 1}, {0, -1, 1}, {0, 1, -1}, {0, -1, -1},
+}
+
+var grad4 = [32][4]float64{
+	{0, 1, 1, 1}, {0, 1, 1, -1}, {0, 1, -1, 1}, {0, 1, -1, -1},
+	{0, -1, 1, 1}, {0, -1, 1, -1}, {0, -1, -1, 1}, {0, -1, -1, -1},
+	{1, 0, 1, 1}, {1, 0, 1, -1}, {1, 0, -1, 1}, {1, 0, -1, -1},
+	{-1, 0, 1, 1}, {-1, 0, 1, -1}, {-1, 0, -1, 1}, {-1, 0, -1, -1},
+	{1, 1, 0, 1}, {1, 1, 0, -1}, {1, -1, 0, 1}, {1, -1, 0, -1},
+	{-1, 1, 0, 1}, {-1, 1, 0, -1}, {-1, -1, 0, 1}, {-1, -1, 0, -1},
+	{1, 1, 1, 0}, {1, 1, -1, 0}, {1, -1, 1, 0}, {1, -1, -1, 0},
+	{-1, 1, 1, 0}, {-1, 1, -1, 0}, {-1, -1, 1, 0}, {-1, -1, -1, 0},
+}
+
+var (
+	f3 = 1.0 / 3.0
+	g3 = 1.0 / 6.0
+	f4 = (math.Sqrt(5.0) - 1.0) / 4.0
+	g4 = (5.0 - math.Sqrt(5.0)) / 20.0
+)
+
+type Simplex struct {
+	perm [2 * pointCount]int
+}
+
+func MakeSimplex(rng *RandExt) *Simplex {
+	s := &Simplex{}
+	p := rng.Perm(pointCount)
+	for i := 0; i < 2*pointCount; i++ {
+		s.perm[i] = p[i&mask]
+	}
+	return s
+}
+
+func fastFloor(x float64) int {
+	return int(math.Floor(x))
+}
+
+func simplexCorner3(t, x, y, z float64, gi int) float64 {
+	if t < 0 {
+		return 0
+	}
+	g := grad3[gi]
+	t *= t
+	return t * t * (g[0]*x + g[1]*y + g[2]*z)
+}
+
+func (this *Simplex) Noise(p *Point3) float64 {
+	return this.Noise3(p.X, p.Y, p.Z)
+}
+
+func (this *Simplex) Noise3(x, y, z float64) float64 {
+	s := (x + y + z) * f3
+	i := fastFloor(x + s)
+	j := fastFloor(y + s)
+	k := fastFloor(z + s)
+	t := float64(i+j+k) * g3
+	x0 := x - (float64(i) - t)
+	y0 := y - (float64(j) - t)
+	z0 := z - (float64(k) - t)
+
+	var i1, j1, k1, i2, j2, k2 int
+	if x0 >= y0 {
+		if y0 >= z0 {
+			i1, j1, k1, i2, j2, k2 = 1, 0, 0, 1, 1, 0
+		} else if x0 >= z0 {
+			i1, j1, k1, i2, j2, k2 = 1, 0, 0, 1, 0, 1
+		} else {
+			i1, j1, k1, i2, j2, k2 = 0, 0, 1, 1, 0, 1
+		}
+	} else {
+		if y0 < z0 {
+			i1, j1, k1, i2, j2, k2 = 0, 0, 1, 0, 1, 1
+		} else if x0 < z0 {
+			i1, j1, k1, i2, j2, k2 = 0, 1, 0, 0, 1, 1
+		} else {
+			i1, j1, k1, i2, j2, k2 = 0, 1, 0, 1, 1, 0
+		}
+	}
+	x1 := x0 - float64(i1) + g3
+	y1 := y0 - float64(j1) + g3
+	z1 := z0 - float64(k1) + g3
+	x2 := x0 - float64(i2) + 2.0*g3
+	y2 := y0 - float64(j2) + 2.0*g3
+	z2 := z0 - float64(k2) + 2.0*g3
+	x3 := x0 - 1.0 + 3.0*g3
+	y3 := y0 - 1.0 + 3.0*g3
+	z3 := z0 - 1.0 + 3.0*g3
+
+	ii := i & mask
+	jj := j & mask
+	kk := k & mask
+	perm := &this.perm
+	gi0 := perm[ii+perm[jj+perm[kk]]] % 12
+	gi1 := perm[ii+i1+perm[jj+j1+perm[kk+k1]]] % 12
+	gi2 := perm[ii+i2+perm[jj+j2+perm[kk+k2]]] % 12
+	gi3 := perm[ii+1+perm[jj+1+perm[kk+1]]] % 12
+
+	n0 := simplexCorner3(0.6-x0*x0-y0*y0-z0*z0, x0, y0, z0, gi0)
+	n1 := simplexCorner3(0.6-x1*x1-y1*y1-z1*z1, x1, y1, z1, gi1)
+	n2 := simplexCorner3(0.6-x2*x2-y2*y2-z2*z2, x2, y2, z2, gi2)
+	n3 := simplexCorner3(0.6-x3*x3-y3*y3-z3*z3, x3, y3, z3, gi3)
+	return 32.0 * (n0 + n1 + n2 + n3)
+}
+
+func simplexCorner4(t, x, y, z, w float64, gi int) float64 {
+	if t < 0 {
+		return 0
+	}
+	g := grad4[gi]
+	t *= t
+	return t * t * (g[0]*x + g[1]*y + g[2]*z + g[3]*w)
+}
+
+func rankStep(rank, threshold int) int {
+	if rank >= threshold {
+		return 1
+	}
+	return 0
+}
+
+func (this *Simplex) Noise4(x, y, z, w float64) float64 {
+	s := (x + y + z + w) * f4
+	i := fastFloor(x + s)
+	j := fastFloor(y + s)
+	k := fastFloor(z + s)
+	l := fastFloor(w + s)
+	t := float64(i+j+k+l) * g4
+	x0 := x - (float64(i) - t)
+	y0 := y - (float64(j) - t)
+	z0 := z - (float64(k) - t)
+	w0 := w - (float64(l) - t)
+
+	rankX, rankY, rankZ, rankW := 0, 0, 0, 0
+	if x0 > y0 {
+		rankX++
+	} else {
+		rankY++
+	}
+	if x0 > z0 {
+		rankX++
+	} else {
+		rankZ++
+	}
+	if x0 > w0 {
+		rankX++
+	} else {
+		rankW++
+	}
+	if y0 > z0 {
+		rankY++
+	} else {
+		rankZ++
+	}
+	if y0 > w0 {
+		rankY++
+	} else {
+		rankW++
+	}
+	if z0 > w0 {
+		rankZ++
+	} else {
+		rankW++
+	}
+
+	perm := &this.perm
+	ii := i & mask
+	jj := j & mask
+	kk := k & mask
+	ll := l & mask
+	acc := simplexCorner4(0.6-x0*x0-y0*y0-z0*z0-w0*w0, x0, y0, z0, w0, perm[ii+perm[jj+perm[kk+perm[ll]]]]%32)
+	for c := 1; c <= 3; c++ {
+		threshold := 4 - c
+		i1 := rankStep(rankX, threshold)
+		j1 := rankStep(rankY, threshold)
+		k1 := rankStep(rankZ, threshold)
+		l1 := rankStep(rankW, threshold)
+		offset := float64(c) * g4
+		xc := x0 - float64(i1) + offset
+		yc := y0 - float64(j1) + offset
+		zc := z0 - float64(k1) + offset
+		wc := w0 - float64(l1) + offset
+		gi := perm[ii+i1+perm[jj+j1+perm[kk+k1+perm[ll+l1]]]] % 32
+		acc += simplexCorner4(0.6-xc*xc-yc*yc-zc*zc-wc*wc, xc, yc, zc, wc, gi)
+	}
+	x4 := x0 - 1.0 + 4.0*g4
+	y4 := y0 - 1.0 + 4.0*g4
+	z4 := z0 - 1.0 + 4.0*g4
+	w4 := w0 - 1.0 + 4.0*g4
+	acc += simplexCorner4(0.6-x4*x4-y4*y4-z4*z4-w4*w4, x4, y4, z4, w4, perm[ii+1+perm[jj+1+perm[kk+1+perm[ll+1]]]]%32)
+	return 27.0 * acc
+}
+
+func (this *Simplex) Fbm(p *Point3, octaves int, lacunarity, gain float64) float64 {
+	return Fbm(this.Noise3, p.X, p.Y, p.Z, octaves, lacunarity, gain)
+}
+
+func (this *Simplex) Fbm4(p *Point3, w float64, octaves int, lacunarity, gain float64) float64 {
+	return Fbm4(this.Noise4, p.X, p.Y, p.Z, w, octaves, lacunarity, gain)
+}
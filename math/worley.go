@@ -0,0 +1,47 @@
+package math
+
+import "math"
+
+type Worley struct {
+	offsets []*Vec3
+	perm    []int
+}
+
+func MakeWorley(rng *RandExt) *Worley {
+	offsets := make([]*Vec3, pointCount)
+	for i := 0; i < pointCount; i++ {
+		offsets[i] = &Vec3{rng.Float64(), rng.Float64(), rng.Float64()}
+	}
+	return &Worley{offsets, rng.Perm(pointCount)}
+}
+
+func (this *Worley) feature(i, j, k int) *Vec3 {
+	h := this.perm[(this.perm[(this.perm[i&mask]+j)&mask]+k)&mask]
+	return this.offsets[h]
+}
+
+func (this *Worley) Noise(p *Point3) (f1, f2 float64) {
+	i := int(math.Floor(p.X))
+	j := int(math.Floor(p.Y))
+	k := int(math.Floor(p.Z))
+	f1 = math.Inf(1)
+	f2 = math.Inf(1)
+	for di := -1; di <= 1; di++ {
+		for dj := -1; dj <= 1; dj++ {
+			for dk := -1; dk <= 1; dk++ {
+				o := this.feature(i+di, j+dj, k+dk)
+				dx := float64(i+di) + o.X - p.X
+				dy := float64(j+dj) + o.Y - p.Y
+				dz := float64(k+dk) + o.Z - p.Z
+				d := math.Sqrt(dx*dx + dy*dy + dz*dz)
+				if d < f1 {
+					f2 = f1
+					f1 = d
+				} else if d < f2 {
+					f2 = d
+				}
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/alexa-infra/rayme/denoise"
+	"github.com/alexa-infra/rayme/imageio"
+)
+
+// mergeCommand combines checkpoints of the same scene rendered with
+// different seeds. Accumulations are added, so every file counts by the
+// samples it holds. It takes the scene and output flags the renders were
+// made with.
+func mergeCommand(args []string) error {
+	flag.CommandLine.Parse(args)
+	if flag.NArg() < 2 {
+		return fmt.Errorf("usage: rayme merge [scene flags] [-o output] render1.ckpt render2.ckpt...")
+	}
+	if *denoiseOutput {
+		if err := denoiseOptions().Check(); err != nil {
+			return err
+		}
+	}
+	if err := loadScene(); err != nil {
+		return err
+	}
+	f, err := setupFrame()
+	if err != nil {
+		return err
+	}
+	r, err := f.newRenderer(*renderSeed)
+	if err != nil {
+		return err
+	}
+	seeds := map[int64]string{}
+	passes := 0
+	for _, path := range flag.Args() {
+		c, err := loadCheckpoint(path)
+		if err != nil {
+			return err
+		}
+		if other, ok := seeds[c.Seed]; ok {
+			return fmt.Errorf("%s and %s were rendered with the same seed %d", other, path, c.Seed)
+		}
+		seeds[c.Seed] = path
+		if err := r.merge(c); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		passes += c.Pass
+	}
+	fmt.Printf("Merged %d renders, samples per pixel: %.2f\n", flag.NArg(), r.samplesPerPixel())
+	meta := imageio.Metadata{
+		"samplesPerPixel": fmt.Sprintf("%.2f", r.samplesPerPixel()),
+		"passes":          fmt.Sprint(passes),
+		"mergedRenders":   fmt.Sprint(flag.NArg()),
+	}
+	img := r.film.Image()
+	if *denoiseOutput {
+		if img, err = denoise.Denoise(img, denoiseGuides(r.passes), denoiseOptions()); err != nil {
+			return err
+		}
+	}
+	return writeRender(*outputPath, img, r.passes, meta)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"github.com/alexa-infra/rayme/imageio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func exrOptions() (imageio.ExrOptions, error) {
+	opts := imageio.ExrOptions{PixelType: imageio.ExrFloat, Compression: imageio.ExrZip}
+	switch *exrPixelType {
+	case "float":
+	case "half":
+		opts.PixelType = imageio.ExrHalf
+	default:
+		return opts, fmt.Errorf("unknown EXR type %q", *exrPixelType)
+	}
+	switch *exrCompression {
+	case "zip":
+	case "none":
+		opts.Compression = imageio.ExrNoCompression
+	default:
+		return opts, fmt.Errorf("unknown EXR compression %q", *exrCompression)
+	}
+	return opts, nil
+}
+
+func displayTransform() (imageio.DisplayTransform, error) {
+	t := imageio.MakeDisplayTransform()
+	op, err := imageio.ParseToneOperator(*toneOperator)
+	if err != nil {
+		return t, err
+	}
+	t.Operator = op
+	t.Exposure = *exposure
+	if *whitePoint <= 0 {
+		return t, fmt.Errorf("white point must be positive")
+	}
+	t.White = *whitePoint
+	return t, nil
+}
+
+func writeOutput(path string, img *imageio.FloatImage) error {
+	return writeOutputWithMetadata(path, img, nil)
+}
+
+// writeOutputWithMetadata writes img, the metadata is dropped for PFM which
+// has no place for it.
+func writeOutputWithMetadata(path string, img *imageio.FloatImage, meta imageio.Metadata) error {
+	var encode func(f *os.File) error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		transform, err := displayTransform()
+		if err != nil {
+			return err
+		}
+		encode = func(f *os.File) error {
+			return imageio.WritePNG(f, transform.ToImage(img), meta)
+		}
+	case ".exr":
+		opts, err := exrOptions()
+		if err != nil {
+			return err
+		}
+		opts.Metadata = meta
+		encode = func(f *os.File) error {
+			return imageio.WriteEXR(f, img, opts)
+		}
+	case ".hdr":
+		encode = func(f *os.File) error {
+			return imageio.WriteHDRWithMetadata(f, img, meta)
+		}
+	case ".pfm":
+		encode = func(f *os.File) error {
+			return imageio.WritePFM(f, img)
+		}
+	default:
+		return fmt.Errorf("unsupported output format %q", filepath.Ext(path))
+	}
+	return writeFile(path, encode)
+}
+
+func writeFile(path string, encode func(f *os.File) error) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("can't open file to write: %v", err)
+	}
+	if err := encode(out); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
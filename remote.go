@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maxJobAttempts = 3
+
+// renderJob asks a worker for passes [From, To) of the frame, passes after
+// the first take Count samples per pixel.
+type renderJob struct {
+	SceneHash string
+	Seed      int64
+	From, To  int
+	Count     int
+	attempts  int
+	failedOn  map[string]bool
+}
+
+// workerCommand serves render jobs over HTTP. The worker is started with
+// the same scene flags as the coordinator, jobs for another scene (by
+// hash) are refused.
+func workerCommand(args []string) error {
+	flag.CommandLine.Parse(args)
+	if err := loadScene(); err != nil {
+		return err
+	}
+	f, err := setupFrame()
+	if err != nil {
+		return err
+	}
+	var busy sync.Mutex
+	mux := http.NewServeMux()
+	mux.HandleFunc("/render", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			http.Error(w, "POST a render job", http.StatusMethodNotAllowed)
+			return
+		}
+		job := &renderJob{}
+		if err := gob.NewDecoder(req.Body).Decode(job); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if job.SceneHash != f.hash {
+			http.Error(w, "scene hash mismatch", http.StatusConflict)
+			return
+		}
+		if job.From < 0 || job.From > job.To || job.Count <= 0 {
+			http.Error(w, fmt.Sprintf("invalid job: passes [%d, %d) with %d samples", job.From, job.To, job.Count), http.StatusBadRequest)
+			return
+		}
+		// a job already uses every core, run them one at a time
+		busy.Lock()
+		defer busy.Unlock()
+		r, err := f.newRenderer(job.Seed)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// stop rendering once the coordinator hangs up, e.g. after its
+		// timeout, it retries the job elsewhere
+		finished := make(chan struct{})
+		defer close(finished)
+		go func() {
+			select {
+			case <-req.Context().Done():
+				r.cancel()
+			case <-finished:
+			}
+		}()
+		r.firstPass, r.pass = job.From, job.From
+		for r.pass < job.To && !r.isCancelled() {
+			r.renderPass(fmt.Sprintf("Job pass %d", r.pass+1), job.Count, func(p *pixelStats) bool { return true })
+		}
+		if err := r.failure(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if r.isCancelled() {
+			log.Printf("Job passes [%d, %d) abandoned by the coordinator", job.From, job.To)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if err := gob.NewEncoder(w).Encode(r.checkpoint()); err != nil {
+			log.Println(err)
+		}
+	})
+	log.Printf("Worker listening on %s", *listenAddr)
+	return http.ListenAndServe(*listenAddr, mux)
+}
+
+// jobQueue hands out passes to remote workers. Failed jobs are retried
+// before new ones are started, preferably on a worker that has not failed
+// them yet.
+type jobQueue struct {
+	sync.Mutex
+	r        *renderer
+	next     int
+	last     int // exclusive, -1 while a time limit decides
+	perJob   int
+	count    int
+	retry    []*renderJob
+	inFlight int
+	alive    map[string]bool
+	err      error
+}
+
+// take returns the next job for the worker at url, or nil with wait set
+// while jobs in flight may still come back for a retry.
+func (this *jobQueue) take(url string) (job *renderJob, wait bool) {
+	this.Lock()
+	defer this.Unlock()
+	if this.err != nil {
+		return nil, false
+	}
+	if this.r.isCancelled() {
+		return nil, this.inFlight > 0
+	}
+	for i, j := range this.retry {
+		if this.canRetry(j, url) {
+			job = j
+			this.retry = append(this.retry[:i], this.retry[i+1:]...)
+			break
+		}
+	}
+	if job == nil && (this.last < 0 || this.next < this.last) {
+		to := this.next + this.perJob
+		if this.last >= 0 && to > this.last {
+			to = this.last
+		}
+		job = &renderJob{SceneHash: this.r.hash, Seed: this.r.seed, From: this.next, To: to, Count: this.count}
+		this.next = to
+	}
+	if job != nil {
+		this.inFlight++
+		return job, false
+	}
+	return nil, this.inFlight > 0 || len(this.retry) > 0
+}
+
+// canRetry tells if url may take job, workers that failed it only get it
+// back once every live worker has failed it.
+func (this *jobQueue) canRetry(job *renderJob, url string) bool {
+	if !job.failedOn[url] {
+		return true
+	}
+	for u := range this.alive {
+		if !job.failedOn[u] {
+			return false
+		}
+	}
+	return true
+}
+
+func (this *jobQueue) done(job *renderJob, result *checkpoint) error {
+	this.Lock()
+	defer this.Unlock()
+	this.inFlight--
+	err := this.r.merge(result)
+	if err == nil {
+		this.r.pass += job.To - job.From
+	} else if this.err == nil {
+		this.err = err
+	}
+	return err
+}
+
+// aborted gives up on a job cut short by cancelling the render, it is
+// neither merged nor retried.
+func (this *jobQueue) aborted() {
+	this.Lock()
+	defer this.Unlock()
+	this.inFlight--
+}
+
+func (this *jobQueue) failed(url string, job *renderJob, err error) {
+	this.Lock()
+	defer this.Unlock()
+	this.inFlight--
+	job.attempts++
+	if job.failedOn == nil {
+		job.failedOn = map[string]bool{}
+	}
+	job.failedOn[url] = true
+	if job.attempts < maxJobAttempts {
+		this.retry = append(this.retry, job)
+	} else if this.err == nil {
+		this.err = fmt.Errorf("passes %d-%d failed %d times: %v", job.From+1, job.To, job.attempts, err)
+	}
+}
+
+// drop stops sending jobs to a worker that keeps failing.
+func (this *jobQueue) drop(url string) {
+	this.Lock()
+	defer this.Unlock()
+	delete(this.alive, url)
+	if len(this.alive) == 0 && this.err == nil {
+		this.err = fmt.Errorf("all workers failed")
+	}
+}
+
+// renderRemote renders the passes on remote workers and merges the
+// results into r, one job at a time per worker.
+func renderRemote(r *renderer, urls []string, lastPass, passesPerJob int) error {
+	if passesPerJob <= 0 {
+		return fmt.Errorf("passes per job must be positive")
+	}
+	queue := &jobQueue{r: r, next: r.pass, last: lastPass, perJob: passesPerJob, count: len(r.samples), alive: map[string]bool{}}
+	for _, url := range urls {
+		queue.alive[url] = true
+	}
+	client := &http.Client{Timeout: time.Hour}
+	// cancelling the render hangs up on the jobs in flight, the workers
+	// stop rendering them
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go func() {
+		select {
+		case <-r.stopped():
+			stop()
+		case <-ctx.Done():
+		}
+	}()
+	var wg sync.WaitGroup
+	for _, url := range urls {
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+			failures := 0
+			for {
+				job, wait := queue.take(url)
+				if job == nil && !wait {
+					return
+				}
+				if job == nil {
+					time.Sleep(200 * time.Millisecond)
+					continue
+				}
+				result, err := postJob(ctx, client, url, job)
+				if err != nil && ctx.Err() != nil {
+					queue.aborted()
+					continue
+				}
+				if err != nil {
+					log.Printf("%s: %v", url, err)
+					queue.failed(url, job, err)
+					failures++
+					if failures >= maxJobAttempts {
+						log.Printf("%s: giving up on this worker", url)
+						queue.drop(url)
+						return
+					}
+					time.Sleep(time.Duration(failures) * time.Second)
+					continue
+				}
+				failures = 0
+				if err := queue.done(job, result); err != nil {
+					return
+				}
+				fmt.Printf("%s: passes %d-%d done\n", url, job.From+1, job.To)
+			}
+		}(url)
+	}
+	wg.Wait()
+	return queue.err
+}
+
+func postJob(ctx context.Context, client *http.Client, url string, job *renderJob) (*checkpoint, error) {
+	body := &bytes.Buffer{}
+	if err := gob.NewEncoder(body).Encode(job); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(url, "/")+"/render", body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg := &bytes.Buffer{}
+		msg.ReadFrom(resp.Body)
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(msg.String()))
+	}
+	result := &checkpoint{}
+	if err := gob.NewDecoder(resp.Body).Decode(result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
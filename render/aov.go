@@ -0,0 +1,153 @@
+package render
+
+import (
+	. "github.com/alexa-infra/rayme/math"
+)
+
+// Aov holds the arbitrary output variables of the first surface seen by a
+// camera ray. IDs start at 1, zero means background or unknown.
+type Aov struct {
+	Hit        bool
+	Depth      float64
+	Normal     *Vec3
+	Position   *Point3
+	Albedo     *Vec3
+	U, V       float64
+	MaterialId int
+	ObjectId   int
+}
+
+// AovIds numbers the objects and materials of a scene in traversal order,
+// so ID passes are stable between renders of the same scene.
+type AovIds struct {
+	objects   map[Hittable]int
+	materials map[Material]int
+}
+
+func MakeAovIds(world Hittable) *AovIds {
+	ids := &AovIds{map[Hittable]int{}, map[Material]int{}}
+	ids.addObjects(world, true)
+	return ids
+}
+
+func (this *AovIds) addObjects(obj Hittable, top bool) {
+	switch o := obj.(type) {
+	case *HittableList:
+		for _, child := range o.Objects {
+			this.addObjects(child, false)
+		}
+		return
+	case *Bvh:
+		this.addObjects(o.left, false)
+		if o.right != o.left {
+			this.addObjects(o.right, false)
+		}
+		return
+	}
+	if _, ok := this.objects[obj]; !ok {
+		this.objects[obj] = len(this.objects) + 1
+	}
+	this.addMaterials(obj)
+}
+
+func (this *AovIds) addMaterials(obj Hittable) {
+	var m Material
+	switch o := obj.(type) {
+	case *HittableList:
+		for _, child := range o.Objects {
+			this.addMaterials(child)
+		}
+	case *Bvh:
+		this.addMaterials(o.left)
+		if o.right != o.left {
+			this.addMaterials(o.right)
+		}
+	case *Mesh:
+		this.addMaterials(o.Bvh)
+	case *Box:
+		this.addMaterials(&o.sides)
+	case *Translate:
+		this.addMaterials(o.obj)
+	case *RotateY:
+		this.addMaterials(o.obj)
+	case *FlipFace:
+		this.addMaterials(o.obj)
+	case *Cutout:
+		this.addMaterials(o.obj)
+	case *Sphere:
+		m = o.Material
+	case *MovingSphere:
+		m = o.Material
+	case *RectXY:
+		m = o.Material
+	case *RectXZ:
+		m = o.Material
+	case *RectYZ:
+		m = o.Material
+	case *Triangle:
+		m = o.material
+	}
+	if m == nil {
+		return
+	}
+	if _, ok := this.materials[m]; !ok {
+		this.materials[m] = len(this.materials) + 1
+	}
+}
+
+// materialAlbedo approximates the reflectance of a material at the hit,
+// it is the albedo pass and the guide used by the denoiser.
+func materialAlbedo(m Material, rec *HitRecord) *Vec3 {
+	switch o := m.(type) {
+	case *Lambertian:
+		return textureValue(o.albedo, rec)
+	case *OrenNayar:
+		return textureValue(o.albedo, rec)
+	case *CoatedDiffuse:
+		return textureValue(o.albedo, rec)
+	case *Metal:
+		return o.albedo
+	case *DiffuseLight:
+		c := textureValue(o.emit, rec)
+		return &Vec3{Clamp(c.X, 0, 1), Clamp(c.Y, 0, 1), Clamp(c.Z, 0, 1)}
+	case *Mix:
+		w := mixAmount(textureValue(o.weight, rec))
+		return materialAlbedo(o.a, rec).Mul(1.0 - w).Add(materialAlbedo(o.b, rec).Mul(w))
+	case *NormalMap:
+		return materialAlbedo(o.Material, rec)
+	case *BumpMap:
+		return materialAlbedo(o.Material, rec)
+	}
+	return &Vec3{1, 1, 1}
+}
+
+// missAov is the AOV of a camera ray that hits nothing, nil when no AOVs
+// are collected.
+func missAov(ids *AovIds) *Aov {
+	if ids == nil {
+		return nil
+	}
+	return &Aov{Normal: noColor, Position: MakePoint3(0, 0, 0), Albedo: noColor}
+}
+
+// hitAov collects the AOVs from the first hit of a camera ray, after
+// shadeHit and before scattering changes the normal or material.
+func hitAov(r *Ray, rec *HitRecord, world Hittable, ids *AovIds) *Aov {
+	if ids == nil {
+		return nil
+	}
+	if rec.object == nil {
+		rec.object = world
+	}
+	return &Aov{
+		Hit:        true,
+		Depth:      rec.t * r.Direction.Length(),
+		Normal:     rec.n,
+		Position:   rec.p,
+		Albedo:     materialAlbedo(rec.Material, rec),
+		U:          rec.u,
+		V:          rec.v,
+		MaterialId: ids.materials[rec.Material],
+		ObjectId:   ids.objects[rec.object],
+	}
+}
@@ -17,10 +17,12 @@ func (this *Bvh) hit(ray *Ray, tMin, tMax float64) (bool, *HitRecord) {
 	}
 	hitLeft, r1 := this.left.hit(ray, tMin, tMax)
 	if hitLeft {
+		tagObject(this.left, r1)
 		tMax = r1.t
 	}
 	hitRight, r2 := this.right.hit(ray, tMin, tMax)
 	if hitRight {
+		tagObject(this.right, r2)
 		return true, r2
 	}
 	return hitLeft, r1
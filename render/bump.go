@@ -0,0 +1,79 @@
+package render
+
+import (
+	. "github.com/alexa-infra/rayme/math"
+)
+
+const bumpDelta = 0.0005
+
+type NormalMap struct {
+	Material
+	normals  Texture
+	strength float64
+}
+
+func MakeNormalMap(m Material, normals Texture, strength float64) *NormalMap {
+	return &NormalMap{m, normals, strength}
+}
+
+func (this *NormalMap) Scatter(r *Ray, rec *HitRecord, rng *RandExt) (bool, *ScatterRecord) {
+	c := textureValue(this.normals, rec)
+	local := &Vec3{
+		(2.0*c.X - 1.0) * this.strength,
+		(2.0*c.Y - 1.0) * this.strength,
+		2.0*c.Z - 1.0,
+	}
+	n := rec.tangentFrame().Local(local).Normalize()
+	if Dot(n, rec.n) > 0 {
+		rec.n = n
+	}
+	rec.Material = this.Material
+	return this.Material.Scatter(r, rec, rng)
+}
+
+func (this *NormalMap) EmittedAt(rec *HitRecord) *Vec3 {
+	return emittedValue(this.Material, rec)
+}
+
+type BumpMap struct {
+	Material
+	height Texture
+	scale  float64
+}
+
+func MakeBumpMap(m Material, height Texture, scale float64) *BumpMap {
+	return &BumpMap{m, height, scale}
+}
+
+func (this *BumpMap) heightAt(rec *HitRecord) float64 {
+	h := textureValue(this.height, rec)
+	return (h.X + h.Y + h.Z) / 3.0
+}
+
+func (this *BumpMap) Scatter(r *Ray, rec *HitRecord, rng *RandExt) (bool, *ScatterRecord) {
+	frame := rec.tangentFrame()
+	dpdu, dpdv := rec.dpdu, rec.dpdv
+	if dpdu == nil || dpdv == nil {
+		dpdu, dpdv = frame.U, frame.V
+	}
+	h := this.heightAt(rec)
+	hu := this.heightAt(rec.withUv(rec.u+bumpDelta, rec.v).withPoint(rec.p.Move(dpdu.Mul(bumpDelta))))
+	hv := this.heightAt(rec.withUv(rec.u, rec.v+bumpDelta).withPoint(rec.p.Move(dpdv.Mul(bumpDelta))))
+	dhdu := (hu - h) / bumpDelta * this.scale
+	dhdv := (hv - h) / bumpDelta * this.scale
+	bumpedU := dpdu.Add(rec.n.Mul(dhdu))
+	bumpedV := dpdv.Add(rec.n.Mul(dhdv))
+	n := Cross(bumpedU, bumpedV).Normalize()
+	if Dot(n, rec.n) < 0 {
+		n = n.Mul(-1.0)
+	}
+	if !n.NearZero() {
+		rec.n = n
+	}
+	rec.Material = this.Material
+	return this.Material.Scatter(r, rec, rng)
+}
+
+func (this *BumpMap) EmittedAt(rec *HitRecord) *Vec3 {
+	return emittedValue(this.Material, rec)
+}
@@ -0,0 +1,57 @@
+package render
+
+import (
+	. "github.com/alexa-infra/rayme/math"
+	"math"
+	"testing"
+)
+
+// slopeTexture rises by one along u.
+type slopeTexture struct{}
+
+func (this *slopeTexture) GetValue(u, v float64, p *Point3) *Vec3 {
+	return &Vec3{u, u, u}
+}
+
+// bumpedNormal is the shading normal m leaves on a hit on the z=0 plane
+// whose u runs along x and v along y.
+func bumpedNormal(m Material) *Vec3 {
+	r, rec := scatteringCase(m, &Vec3{0, 0, 1})
+	rec.withTangents(&Vec3{1, 0, 0}, &Vec3{0, 1, 0})
+	m.Scatter(r, rec, MakeRandExt(1))
+	return rec.n
+}
+
+func sameDirection(t *testing.T, name string, got, want *Vec3) {
+	t.Helper()
+	if d := got.Sub(want.Normalize()).Length(); d > 1e-6 {
+		t.Errorf("%s: normal %v, want %v", name, got, want.Normalize())
+	}
+}
+
+func TestNormalMap(t *testing.T) {
+	base := MakeLambertianSolidColor(&Vec3{0.5, 0.5, 0.5})
+	flat := MakeNormalMap(base, MakeSolidColor(&Vec3{0.5, 0.5, 1}), 1)
+	sameDirection(t, "flat", bumpedNormal(flat), &Vec3{0, 0, 1})
+	tilted := MakeNormalMap(base, MakeSolidColor(&Vec3{1, 0.5, 1}), 1)
+	sameDirection(t, "tilted", bumpedNormal(tilted), &Vec3{1, 0, 1})
+	half := MakeNormalMap(base, MakeSolidColor(&Vec3{1, 0.5, 1}), 0.5)
+	sameDirection(t, "half strength", bumpedNormal(half), &Vec3{0.5, 0, 1})
+	// a map pointing under the surface is ignored
+	under := MakeNormalMap(base, MakeSolidColor(&Vec3{0.5, 0.5, 0}), 1)
+	sameDirection(t, "under", bumpedNormal(under), &Vec3{0, 0, 1})
+}
+
+func TestBumpMap(t *testing.T) {
+	base := MakeLambertianSolidColor(&Vec3{0.5, 0.5, 0.5})
+	flat := MakeBumpMap(base, MakeSolidColor(&Vec3{0.7, 0.7, 0.7}), 3)
+	sameDirection(t, "flat", bumpedNormal(flat), &Vec3{0, 0, 1})
+	for _, scale := range []float64{0.5, 2} {
+		sloped := MakeBumpMap(base, &slopeTexture{}, scale)
+		n := bumpedNormal(sloped)
+		sameDirection(t, "sloped", n, &Vec3{-scale, 0, 1})
+		if math.Abs(n.Length()-1) > 1e-9 {
+			t.Errorf("bumped normal %v is not unit length", n)
+		}
+	}
+}
@@ -13,6 +13,8 @@ type Camera struct {
 	onb             *Onb
 	lensRadius      float64
 	t1, t2          float64
+	viewportHeight  float64
+	pixelSpread     float64
 }
 
 func MakeCamera(lookFrom, lookAt *Point3, vup *Vec3, vfov float64, aspectRatio float64, aperture float64, focusDist float64, t1, t2 float64) *Camera {
@@ -28,7 +30,11 @@ func MakeCamera(lookFrom, lookAt *Point3, vup *Vec3, vfov float64, aspectRatio f
 	forward := onb.W.Mul(-focusDist)
 	lowerLeftCorner := origin.Move(horizontal.Mul(-0.5)).Move(vertical.Mul(-0.5)).Move(forward)
 	lensRadius := aperture / 2.0
-	return &Camera{origin, horizontal, vertical, lowerLeftCorner, onb, lensRadius, t1, t2}
+	return &Camera{origin, horizontal, vertical, lowerLeftCorner, onb, lensRadius, t1, t2, viewportHeight, 0.0}
+}
+
+func (c *Camera) SetImageHeight(imageHeight int) {
+	c.pixelSpread = c.viewportHeight / float64(imageHeight)
 }
 
 func (c *Camera) CastRay(s, t float64, rng *RandExt) *Ray {
@@ -39,5 +45,8 @@ func (c *Camera) CastRay(s, t float64, rng *RandExt) *Ray {
 		origin = origin.Move(offset)
 	}
 	target := c.lowerLeftCorner.Move(c.horizontal.Mul(s)).Move(c.vertical.Mul(t))
-	return MakeRayFromPoints(origin, target, rng.Between(c.t1, c.t2))
+	ray := MakeRayFromPoints(origin, target, rng.Between(c.t1, c.t2))
+	ray.Spread = c.pixelSpread
+	ray.Sample = rng.Float64()
+	return ray
 }
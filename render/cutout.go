@@ -0,0 +1,78 @@
+package render
+
+import (
+	. "github.com/alexa-infra/rayme/math"
+	"math"
+)
+
+const (
+	cutoutMaxLayers = 16
+	cutoutEpsilon   = 0.0001
+)
+
+// Cutout makes an object transparent where its alpha texture is low.
+type Cutout struct {
+	obj        Hittable
+	alpha      Texture
+	threshold  float64
+	stochastic bool
+}
+
+func MakeCutout(obj Hittable, alpha Texture, threshold float64) *Cutout {
+	return &Cutout{obj, alpha, threshold, false}
+}
+
+func MakeStochasticCutout(obj Hittable, alpha Texture) *Cutout {
+	return &Cutout{obj, alpha, 0.0, true}
+}
+
+func (this *Cutout) opaque(r *Ray, rec *HitRecord) bool {
+	c := textureValue(this.alpha, rec)
+	a := (c.X + c.Y + c.Z) / 3.0
+	if this.stochastic {
+		return a > hashToUnit(rec.p.Vec3, r.Sample)
+	}
+	return a >= this.threshold
+}
+
+func (this *Cutout) hit(r *Ray, tMin, tMax float64) (bool, *HitRecord) {
+	for i := 0; i < cutoutMaxLayers; i++ {
+		hit, rec := this.obj.hit(r, tMin, tMax)
+		if !hit {
+			return false, nil
+		}
+		if this.opaque(r, rec) {
+			return true, rec
+		}
+		tMin = rec.t + cutoutEpsilon
+	}
+	return false, nil
+}
+
+func (this *Cutout) boundingBox(t0, t1 float64) (bool, *Aabb) {
+	return this.obj.boundingBox(t0, t1)
+}
+
+// pdfValue ignores alpha, rays drawn into cut-away regions pass through.
+func (this *Cutout) pdfValue(origin *Point3, v *Vec3) float64 {
+	return this.obj.pdfValue(origin, v)
+}
+
+func (this *Cutout) random(origin *Point3, rng *RandExt) *Vec3 {
+	return this.obj.random(origin, rng)
+}
+
+// hashToUnit mixes the ray sample with the hit point, so every layer a ray
+// crosses gets its own random number.
+func hashToUnit(p *Vec3, sample float64) float64 {
+	h := uint64(0x9e3779b97f4a7c15)
+	for _, f := range []float64{p.X, p.Y, p.Z, sample} {
+		h ^= math.Float64bits(f) + 0x9e3779b97f4a7c15 + (h << 6) + (h >> 2)
+		h ^= h >> 30
+		h *= 0xbf58476d1ce4e5b9
+		h ^= h >> 27
+		h *= 0x94d049bb133111eb
+		h ^= h >> 31
+	}
+	return float64(h>>11) / float64(1<<53)
+}
@@ -0,0 +1,27 @@
+package render
+
+import (
+	. "github.com/alexa-infra/rayme/math"
+	"math"
+	"testing"
+)
+
+func TestStochasticCutoutAverages(t *testing.T) {
+	sphere := &Sphere{MakePoint3(0, 0, 0), 1, MakeLambertianSolidColor(&Vec3{0.5, 0.5, 0.5})}
+	cutout := MakeStochasticCutout(sphere, MakeSolidColor(&Vec3{0.3, 0.3, 0.3}))
+	rng := MakeRandExt(1)
+	// one ray through the centre crosses the sphere twice, it gets through
+	// with probability 0.7*0.7
+	const n = 20000
+	passed := 0
+	for i := 0; i < n; i++ {
+		r := MakeRayFromPoints(MakePoint3(0, 0, -5), MakePoint3(0, 0, 0), 0)
+		r.Sample = rng.Float64()
+		if hit, _ := cutout.hit(r, 0.001, 100); !hit {
+			passed++
+		}
+	}
+	if got := float64(passed) / n; math.Abs(got-0.49) > 0.02 {
+		t.Errorf("%.3f of the rays passed, want 0.49", got)
+	}
+}
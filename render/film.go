@@ -0,0 +1,95 @@
+package render
+
+import (
+	"fmt"
+	"github.com/alexa-infra/rayme/imageio"
+	. "github.com/alexa-infra/rayme/math"
+	"math"
+	"sync"
+)
+
+// Film accumulates filtered samples. Coordinates are in raster space, x to
+// the right and y down, with pixel centres at integer positions. A sample
+// is splatted into every pixel within the filter radius, so concurrent
+// writers are serialised per row.
+type Film struct {
+	width, height int
+	filter        Filter
+	sum           []float64
+	weight        []float64
+	rows          []sync.Mutex
+}
+
+func MakeFilm(width, height int, filter Filter) *Film {
+	return &Film{
+		width:  width,
+		height: height,
+		filter: filter,
+		sum:    make([]float64, 3*width*height),
+		weight: make([]float64, width*height),
+		rows:   make([]sync.Mutex, height),
+	}
+}
+
+func (this *Film) AddSample(x, y float64, c *Vec3) {
+	r := this.filter.Radius()
+	x0 := int(math.Max(math.Ceil(x-r), 0))
+	x1 := int(math.Min(math.Floor(x+r), float64(this.width-1)))
+	y0 := int(math.Max(math.Ceil(y-r), 0))
+	y1 := int(math.Min(math.Floor(y+r), float64(this.height-1)))
+	for py := y0; py <= y1; py++ {
+		this.rows[py].Lock()
+		for px := x0; px <= x1; px++ {
+			w := this.filter.Evaluate(float64(px)-x, float64(py)-y)
+			if w == 0 {
+				continue
+			}
+			i := py*this.width + px
+			this.sum[3*i] += w * c.X
+			this.sum[3*i+1] += w * c.Y
+			this.sum[3*i+2] += w * c.Z
+			this.weight[i] += w
+		}
+		this.rows[py].Unlock()
+	}
+}
+
+// Image resolves the film, pixels without positive filter weight are black.
+// It may be called while samples are added, e.g. to preview a render.
+func (this *Film) Image() *imageio.FloatImage {
+	img := imageio.MakeFloatImage(this.width, this.height)
+	for y := 0; y < this.height; y++ {
+		this.rows[y].Lock()
+		for i := y * this.width; i < (y+1)*this.width; i++ {
+			w := this.weight[i]
+			if w <= 1e-8 {
+				continue
+			}
+			img.Pix[3*i] = float32(this.sum[3*i] / w)
+			img.Pix[3*i+1] = float32(this.sum[3*i+1] / w)
+			img.Pix[3*i+2] = float32(this.sum[3*i+2] / w)
+		}
+		this.rows[y].Unlock()
+	}
+	return img
+}
+
+// Accumulation returns copies of the weighted sums and filter weights.
+func (this *Film) Accumulation() (sum, weight []float64) {
+	return append([]float64{}, this.sum...), append([]float64{}, this.weight...)
+}
+
+// AddAccumulation adds sums and weights saved from a film of the same size,
+// e.g. an earlier part of the render or another render of the same frame.
+func (this *Film) AddAccumulation(sum, weight []float64) error {
+	if len(sum) != len(this.sum) || len(weight) != len(this.weight) {
+		return fmt.Errorf("film size mismatch")
+	}
+	for i, v := range sum {
+		this.sum[i] += v
+	}
+	for i, v := range weight {
+		this.weight[i] += v
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package render
+
+import (
+	"math"
+)
+
+// Filter is a pixel reconstruction filter, Evaluate takes the offset of a
+// sample from a pixel centre and is zero outside Radius.
+type Filter interface {
+	Radius() float64
+	Evaluate(x, y float64) float64
+}
+
+type BoxFilter struct {
+	radius float64
+}
+
+func MakeBoxFilter(radius float64) *BoxFilter {
+	return &BoxFilter{radius}
+}
+
+func (this *BoxFilter) Radius() float64 {
+	return this.radius
+}
+
+func (this *BoxFilter) Evaluate(x, y float64) float64 {
+	if math.Abs(x) > this.radius || math.Abs(y) > this.radius {
+		return 0
+	}
+	return 1
+}
+
+type TentFilter struct {
+	radius float64
+}
+
+func MakeTentFilter(radius float64) *TentFilter {
+	return &TentFilter{radius}
+}
+
+func (this *TentFilter) Radius() float64 {
+	return this.radius
+}
+
+func (this *TentFilter) Evaluate(x, y float64) float64 {
+	return math.Max(0, this.radius-math.Abs(x)) * math.Max(0, this.radius-math.Abs(y))
+}
+
+type GaussianFilter struct {
+	radius, alpha, edge float64
+}
+
+// MakeGaussianFilter builds a Gaussian with falloff alpha, shifted down so
+// it reaches zero at the radius.
+func MakeGaussianFilter(radius, alpha float64) *GaussianFilter {
+	return &GaussianFilter{radius, alpha, math.Exp(-alpha * radius * radius)}
+}
+
+func (this *GaussianFilter) Radius() float64 {
+	return this.radius
+}
+
+func (this *GaussianFilter) gaussian(d float64) float64 {
+	return math.Max(0, math.Exp(-this.alpha*d*d)-this.edge)
+}
+
+func (this *GaussianFilter) Evaluate(x, y float64) float64 {
+	return this.gaussian(x) * this.gaussian(y)
+}
+
+type MitchellFilter struct {
+	radius, b, c float64
+}
+
+// MakeMitchellFilter builds a Mitchell-Netravali filter, b = c = 1/3 is
+// the usual choice.
+func MakeMitchellFilter(radius, b, c float64) *MitchellFilter {
+	return &MitchellFilter{radius, b, c}
+}
+
+func (this *MitchellFilter) Radius() float64 {
+	return this.radius
+}
+
+func (this *MitchellFilter) mitchell(x float64) float64 {
+	x = math.Abs(2 * x / this.radius)
+	b, c := this.b, this.c
+	if x > 2 {
+		return 0
+	}
+	if x > 1 {
+		return ((-b-6*c)*x*x*x + (6*b+30*c)*x*x + (-12*b-48*c)*x + (8*b + 24*c)) / 6
+	}
+	return ((12-9*b-6*c)*x*x*x + (-18+12*b+6*c)*x*x + (6 - 2*b)) / 6
+}
+
+func (this *MitchellFilter) Evaluate(x, y float64) float64 {
+	return this.mitchell(x) * this.mitchell(y)
+}
+
+type LanczosFilter struct {
+	radius, tau float64
+}
+
+// MakeLanczosFilter builds a sinc filter windowed by a sinc stretched to
+// tau lobes.
+func MakeLanczosFilter(radius, tau float64) *LanczosFilter {
+	return &LanczosFilter{radius, tau}
+}
+
+func (this *LanczosFilter) Radius() float64 {
+	return this.radius
+}
+
+func sinc(x float64) float64 {
+	if math.Abs(x) < 1e-5 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+func (this *LanczosFilter) lanczos(x float64) float64 {
+	x = math.Abs(x)
+	if x > this.radius {
+		return 0
+	}
+	return sinc(x) * sinc(x/this.tau)
+}
+
+func (this *LanczosFilter) Evaluate(x, y float64) float64 {
+	return this.lanczos(x) * this.lanczos(y)
+}
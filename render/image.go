@@ -0,0 +1,424 @@
+package render
+
+import (
+	"github.com/alexa-infra/rayme/imageio"
+	. "github.com/alexa-infra/rayme/math"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type WrapMode int
+
+const (
+	WrapClamp WrapMode = iota
+	WrapRepeat
+	WrapMirror
+)
+
+type FilterMode int
+
+const (
+	FilterNearest FilterMode = iota
+	FilterBilinear
+	FilterTrilinear
+	FilterAnisotropic
+)
+
+const maxAnisotropy = 8
+
+type mipLevel struct {
+	width, height int
+	pix           []float64
+}
+
+func (this *mipLevel) texel(x, y int) *Vec3 {
+	i := 3 * (y*this.width + x)
+	return &Vec3{this.pix[i], this.pix[i+1], this.pix[i+2]}
+}
+
+func (this *mipLevel) downsample() *mipLevel {
+	w := this.width / 2
+	if w < 1 {
+		w = 1
+	}
+	h := this.height / 2
+	if h < 1 {
+		h = 1
+	}
+	pix := make([]float64, 3*w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			x0 := Min(float64(2*x), float64(this.width-1))
+			x1 := Min(float64(2*x+1), float64(this.width-1))
+			y0 := Min(float64(2*y), float64(this.height-1))
+			y1 := Min(float64(2*y+1), float64(this.height-1))
+			c := this.texel(int(x0), int(y0)).
+				Add(this.texel(int(x1), int(y0))).
+				Add(this.texel(int(x0), int(y1))).
+				Add(this.texel(int(x1), int(y1))).
+				Mul(0.25)
+			i := 3 * (y*w + x)
+			pix[i], pix[i+1], pix[i+2] = c.X, c.Y, c.Z
+		}
+	}
+	return &mipLevel{w, h, pix}
+}
+
+type imageData struct {
+	base   *mipLevel
+	once   sync.Once
+	levels []*mipLevel
+}
+
+func (this *imageData) mipmaps() []*mipLevel {
+	this.once.Do(func() {
+		level := this.base
+		this.levels = []*mipLevel{level}
+		for level.width > 1 || level.height > 1 {
+			level = level.downsample()
+			this.levels = append(this.levels, level)
+		}
+	})
+	return this.levels
+}
+
+// imageCacheSize is how many decoded images are kept for reuse, the least
+// recently used are dropped beyond it.
+const imageCacheSize = 16
+
+// imageCacheEntry is a decoded file, ready is closed once data or err are
+// set. A changed size or modification time makes the file read again.
+type imageCacheEntry struct {
+	modTime time.Time
+	size    int64
+	used    int64
+	ready   chan struct{}
+	data    *imageData
+	err     error
+}
+
+var imageCache = struct {
+	sync.Mutex
+	entries map[string]*imageCacheEntry
+	clock   int64
+}{entries: map[string]*imageCacheEntry{}}
+
+type ImageTexture struct {
+	levels []*mipLevel
+	wrap   WrapMode
+	filter FilterMode
+}
+
+func MakeImageTexture(path string) (*ImageTexture, error) {
+	return MakeFilteredImageTexture(path, WrapClamp, FilterNearest)
+}
+
+func MakeFilteredImageTexture(path string, wrap WrapMode, filter FilterMode) (*ImageTexture, error) {
+	data, err := loadImageData(path, false)
+	if err != nil {
+		return nil, err
+	}
+	return makeImageTexture(data, wrap, filter), nil
+}
+
+func MakeDataImageTexture(path string, wrap WrapMode, filter FilterMode) (*ImageTexture, error) {
+	data, err := loadImageData(path, true)
+	if err != nil {
+		return nil, err
+	}
+	return makeImageTexture(data, wrap, filter), nil
+}
+
+func MakeImageTextureFromImage(img image.Image, wrap WrapMode, filter FilterMode) *ImageTexture {
+	return makeImageTexture(&imageData{base: decodeImage(img, false)}, wrap, filter)
+}
+
+func MakeImageTextureFromFloat(img *imageio.FloatImage, wrap WrapMode, filter FilterMode) *ImageTexture {
+	return makeImageTexture(&imageData{base: floatLevel(img)}, wrap, filter)
+}
+
+func makeImageTexture(data *imageData, wrap WrapMode, filter FilterMode) *ImageTexture {
+	levels := []*mipLevel{data.base}
+	if filter == FilterTrilinear || filter == FilterAnisotropic {
+		levels = data.mipmaps()
+	}
+	return &ImageTexture{levels, wrap, filter}
+}
+
+func loadImageData(path string, raw bool) (*imageData, error) {
+	key, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	if raw {
+		key += "#raw"
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	imageCache.Lock()
+	imageCache.clock++
+	entry, ok := imageCache.entries[key]
+	if !ok || !entry.modTime.Equal(info.ModTime()) || entry.size != info.Size() {
+		entry = &imageCacheEntry{modTime: info.ModTime(), size: info.Size(), used: imageCache.clock, ready: make(chan struct{})}
+		imageCache.entries[key] = entry
+		evictImages()
+		ok = false
+	}
+	entry.used = imageCache.clock
+	imageCache.Unlock()
+	if ok {
+		<-entry.ready
+		return entry.data, entry.err
+	}
+	// decode without the lock, other files can load meanwhile
+	base, err := readImageFile(path, raw)
+	if err == nil {
+		entry.data = &imageData{base: base}
+	}
+	entry.err = err
+	close(entry.ready)
+	if err != nil {
+		imageCache.Lock()
+		if imageCache.entries[key] == entry {
+			delete(imageCache.entries, key)
+		}
+		imageCache.Unlock()
+	}
+	return entry.data, err
+}
+
+// evictImages drops the least recently used images beyond the cache size,
+// textures made from them keep their data.
+func evictImages() {
+	for len(imageCache.entries) > imageCacheSize {
+		oldest := ""
+		for key, entry := range imageCache.entries {
+			if oldest == "" || entry.used < imageCache.entries[oldest].used {
+				oldest = key
+			}
+		}
+		delete(imageCache.entries, oldest)
+	}
+}
+
+func readImageFile(path string, raw bool) (*mipLevel, error) {
+	reader, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".hdr", ".pic":
+		img, err := imageio.ReadHDR(reader)
+		if err != nil {
+			return nil, err
+		}
+		return floatLevel(img), nil
+	case ".pfm":
+		img, err := imageio.ReadPFM(reader)
+		if err != nil {
+			return nil, err
+		}
+		return floatLevel(img), nil
+	}
+	img, _, err := image.Decode(reader)
+	if err != nil {
+		return nil, err
+	}
+	return decodeImage(img, raw), nil
+}
+
+func floatLevel(img *imageio.FloatImage) *mipLevel {
+	pix := make([]float64, len(img.Pix))
+	for i, v := range img.Pix {
+		pix[i] = float64(v)
+	}
+	return &mipLevel{img.Width, img.Height, pix}
+}
+
+func isEightBit(img image.Image) bool {
+	switch img.(type) {
+	case *image.RGBA, *image.NRGBA, *image.YCbCr, *image.Paletted, *image.Gray, *image.CMYK:
+		return true
+	}
+	return false
+}
+
+func decodeImage(img image.Image, raw bool) *mipLevel {
+	bounds := img.Bounds()
+	size := bounds.Size()
+	pix := make([]float64, 3*size.X*size.Y)
+	scale := 1.0 / float64(0xffff)
+	srgb := !raw && isEightBit(img)
+	for y := 0; y < size.Y; y++ {
+		for x := 0; x < size.X; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			c := &Vec3{float64(r) * scale, float64(g) * scale, float64(b) * scale}
+			if srgb {
+				c = &Vec3{imageio.SrgbToLinear(c.X), imageio.SrgbToLinear(c.Y), imageio.SrgbToLinear(c.Z)}
+			}
+			i := 3 * (y*size.X + x)
+			pix[i], pix[i+1], pix[i+2] = c.X, c.Y, c.Z
+		}
+	}
+	return &mipLevel{size.X, size.Y, pix}
+}
+
+func wrapCoord(x, size int, wrap WrapMode) int {
+	switch wrap {
+	case WrapRepeat:
+		x %= size
+		if x < 0 {
+			x += size
+		}
+	case WrapMirror:
+		period := 2 * size
+		x %= period
+		if x < 0 {
+			x += period
+		}
+		if x >= size {
+			x = period - 1 - x
+		}
+	default:
+		if x < 0 {
+			x = 0
+		} else if x >= size {
+			x = size - 1
+		}
+	}
+	return x
+}
+
+func (this *ImageTexture) nearest(level *mipLevel, u, v float64) *Vec3 {
+	if this.wrap == WrapClamp {
+		u = Clamp(u, 0.0, 1.0)
+		v = Clamp(v, 0.0, 1.0)
+	}
+	x := int(math.Floor(u * float64(level.width)))
+	y := int(math.Floor((1.0 - v) * float64(level.height)))
+	return level.texel(wrapCoord(x, level.width, this.wrap), wrapCoord(y, level.height, this.wrap))
+}
+
+func (this *ImageTexture) bilinear(level *mipLevel, u, v float64) *Vec3 {
+	fx := u*float64(level.width) - 0.5
+	fy := (1.0-v)*float64(level.height) - 0.5
+	x0 := math.Floor(fx)
+	y0 := math.Floor(fy)
+	dx := fx - x0
+	dy := fy - y0
+	ix0 := wrapCoord(int(x0), level.width, this.wrap)
+	ix1 := wrapCoord(int(x0)+1, level.width, this.wrap)
+	iy0 := wrapCoord(int(y0), level.height, this.wrap)
+	iy1 := wrapCoord(int(y0)+1, level.height, this.wrap)
+	top := level.texel(ix0, iy0).Mul(1 - dx).Add(level.texel(ix1, iy0).Mul(dx))
+	bottom := level.texel(ix0, iy1).Mul(1 - dx).Add(level.texel(ix1, iy1).Mul(dx))
+	return top.Mul(1 - dy).Add(bottom.Mul(dy))
+}
+
+func (this *ImageTexture) trilinear(u, v, width float64) *Vec3 {
+	base := this.levels[0]
+	texels := width * float64(base.width)
+	if base.height > base.width {
+		texels = width * float64(base.height)
+	}
+	if texels <= 1.0 {
+		return this.bilinear(base, u, v)
+	}
+	lod := math.Log2(texels)
+	last := float64(len(this.levels) - 1)
+	if lod >= last {
+		return this.bilinear(this.levels[len(this.levels)-1], u, v)
+	}
+	i := int(lod)
+	t := lod - float64(i)
+	a := this.bilinear(this.levels[i], u, v)
+	b := this.bilinear(this.levels[i+1], u, v)
+	return a.Mul(1 - t).Add(b.Mul(t))
+}
+
+func (this *ImageTexture) GetValue(u, v float64, p *Point3) *Vec3 {
+	switch this.filter {
+	case FilterNearest:
+		return this.nearest(this.levels[0], u, v)
+	default:
+		return this.bilinear(this.levels[0], u, v)
+	}
+}
+
+func (this *ImageTexture) GetSurfaceValue(rec *HitRecord) *Vec3 {
+	if this.filter == FilterNearest || this.filter == FilterBilinear {
+		return this.GetValue(rec.u, rec.v, rec.p)
+	}
+	if rec.footprint <= 0 || rec.dpdu == nil || rec.dpdv == nil {
+		return this.bilinear(this.levels[0], rec.u, rec.v)
+	}
+	major, minor := footprintAxes(rec)
+	if this.filter == FilterTrilinear {
+		width := Max(math.Hypot(major[0], major[1]), math.Hypot(minor[0], minor[1]))
+		return this.trilinear(rec.u, rec.v, width)
+	}
+	return this.anisotropic(rec.u, rec.v, major, minor)
+}
+
+func (this *ImageTexture) anisotropic(u, v float64, major, minor [2]float64) *Vec3 {
+	majorLen := math.Hypot(major[0], major[1])
+	minorLen := math.Hypot(minor[0], minor[1])
+	if minorLen*maxAnisotropy < majorLen {
+		minorLen = majorLen / maxAnisotropy
+	}
+	if minorLen <= 0 {
+		return this.bilinear(this.levels[0], u, v)
+	}
+	probes := int(math.Ceil(majorLen / minorLen))
+	if probes < 1 {
+		probes = 1
+	}
+	sum := &Vec3{0, 0, 0}
+	totalWeight := 0.0
+	for i := 0; i < probes; i++ {
+		s := 0.0
+		if probes > 1 {
+			s = float64(i)/float64(probes-1) - 0.5
+		}
+		r := 2.0 * s
+		weight := math.Exp(-2.0 * r * r)
+		c := this.trilinear(u+s*major[0], v+s*major[1], minorLen)
+		sum = sum.Add(c.Mul(weight))
+		totalWeight += weight
+	}
+	return sum.Mul(1.0 / totalWeight)
+}
+
+func footprintAxes(rec *HitRecord) (major, minor [2]float64) {
+	toUv := func(d *Vec3) [2]float64 {
+		return [2]float64{
+			Dot(d, rec.dpdu) / rec.dpdu.Length2(),
+			Dot(d, rec.dpdv) / rec.dpdv.Length2(),
+		}
+	}
+	frame := rec.tangentFrame()
+	along := frame.U
+	cosine := 1.0
+	if rec.rayDir != nil {
+		cosine = Max(Abs(Dot(rec.rayDir, rec.n)), 0.05)
+		projected := rec.rayDir.Sub(rec.n.Mul(Dot(rec.rayDir, rec.n)))
+		if !projected.NearZero() {
+			along = projected.Normalize()
+		}
+	}
+	across := Cross(rec.n, along)
+	major = toUv(along.Mul(rec.footprint / cosine))
+	minor = toUv(across.Mul(rec.footprint))
+	return
+}
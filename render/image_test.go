@@ -0,0 +1,62 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestPng(t *testing.T, path string, c color.Color) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	for i := 0; i < 4; i++ {
+		img.Set(i%2, i/2, c)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImageCacheReloadsChangedFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tex.png")
+	writeTestPng(t, path, color.RGBA{255, 0, 0, 255})
+	a, err := loadImageData(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := loadImageData(path, true); a != b {
+		t.Error("unchanged file was decoded again")
+	}
+	writeTestPng(t, path, color.RGBA{0, 0, 255, 255})
+	later := time.Now().Add(time.Second)
+	os.Chtimes(path, later, later)
+	c, err := loadImageData(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c == a || c.base.pix[2] != 1 {
+		t.Errorf("edited file was not reloaded")
+	}
+}
+
+func TestImageCacheSize(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 2*imageCacheSize; i++ {
+		path := filepath.Join(dir, string(rune('a'+i))+".png")
+		writeTestPng(t, path, color.Gray{uint8(i)})
+		if _, err := loadImageData(path, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(imageCache.entries); n > imageCacheSize {
+		t.Errorf("cache holds %d images", n)
+	}
+}
@@ -0,0 +1,84 @@
+package render
+
+import (
+	. "github.com/alexa-infra/rayme/math"
+)
+
+// RadianceComponents splits the radiance of a camera ray by the first
+// scattering event on the path. Emission is light seen directly, including
+// the background behind a camera ray that misses. Direct terms end on a light
+// or the background after one bounce, indirect ones after more. Later
+// bounces do not change the class, a diffuse hit seen in a mirror is
+// specular.
+type RadianceComponents struct {
+	Emission         *Vec3
+	DirectDiffuse    *Vec3
+	IndirectDiffuse  *Vec3
+	DirectSpecular   *Vec3
+	IndirectSpecular *Vec3
+	Transmission     *Vec3
+}
+
+func (this *RadianceComponents) Sum() *Vec3 {
+	return this.Emission.
+		Add(this.DirectDiffuse).
+		Add(this.IndirectDiffuse).
+		Add(this.DirectSpecular).
+		Add(this.IndirectSpecular).
+		Add(this.Transmission)
+}
+
+func GetRayComponents(r *Ray, bgColor *Vec3, world Hittable, lights Hittable, depth int, rng *RandExt) *RadianceComponents {
+	c, _ := GetRayComponentsAov(r, bgColor, world, lights, depth, rng, nil)
+	return c
+}
+
+// GetRayComponentsAov is GetRayComponents that also returns the AOVs of
+// the first hit when ids is set.
+func GetRayComponentsAov(r *Ray, bgColor *Vec3, world Hittable, lights Hittable, depth int, rng *RandExt, ids *AovIds) (*RadianceComponents, *Aov) {
+	c := &RadianceComponents{noColor, noColor, noColor, noColor, noColor, noColor}
+	if depth <= 0 {
+		return c, missAov(ids)
+	}
+	hit, rec := world.hit(r, 0.001, 10000)
+	if !hit {
+		c.Emission = bgColor
+		return c, missAov(ids)
+	}
+	c.Emission = shadeHit(r, rec)
+	aov := hitAov(r, rec, world, ids)
+	scattered, srec := sampleScatter(r, rec, lights, rng)
+	if !scattered {
+		return c, aov
+	}
+	direct, indirect := splitRadiance(srec.specular, bgColor, world, lights, depth-1, rng)
+	direct = direct.MulVec(srec.attenuation)
+	indirect = indirect.MulVec(srec.attenuation)
+	switch {
+	case !srec.isSpecular:
+		c.DirectDiffuse, c.IndirectDiffuse = direct, indirect
+	case Dot(srec.specular.Direction, rec.n) < 0:
+		c.Transmission = direct.Add(indirect)
+	default:
+		c.DirectSpecular, c.IndirectSpecular = direct, indirect
+	}
+	return c, aov
+}
+
+// splitRadiance separates the light arriving along r into what the next
+// vertex emits and what it scatters.
+func splitRadiance(r *Ray, bgColor *Vec3, world Hittable, lights Hittable, depth int, rng *RandExt) (direct, indirect *Vec3) {
+	if depth <= 0 {
+		return noColor, noColor
+	}
+	hit, rec := world.hit(r, 0.001, 10000)
+	if !hit {
+		return bgColor, noColor
+	}
+	emitted := shadeHit(r, rec)
+	scattered, srec := sampleScatter(r, rec, lights, rng)
+	if !scattered {
+		return emitted, noColor
+	}
+	return emitted, GetRayColor(srec.specular, bgColor, world, lights, depth-1, rng).MulVec(srec.attenuation)
+}
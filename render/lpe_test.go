@@ -0,0 +1,60 @@
+package render
+
+import (
+	. "github.com/alexa-infra/rayme/math"
+	"testing"
+)
+
+type lpeScene struct {
+	world, lights Hittable
+	bg            *Vec3
+}
+
+func makeLpeScene() *lpeScene {
+	light := MakeDiffuseLightFromColor(&Vec3{4, 4, 4})
+	world := &HittableList{Objects: []Hittable{
+		MakeRectXZ(-10, -10, 10, 10, 0, MakeLambertianSolidColor(&Vec3{0.5, 0.5, 0.5})),
+		&Sphere{MakePoint3(-1, 1, 0), 1, MakeMetal(&Vec3{0.8, 0.8, 0.8}, 0.2)},
+		&Sphere{MakePoint3(1.2, 0.8, 0.5), 0.8, MakeDielectric(1.5)},
+		MakeFlipFace(MakeRectXZ(-2, -2, 2, 2, 5, light)),
+	}}
+	lights := &HittableList{Objects: []Hittable{MakeRectXZ(-2, -2, 2, 2, 5, nil)}}
+	return &lpeScene{world, lights, &Vec3{0.2, 0.3, 0.5}}
+}
+
+func (this *lpeScene) components(r *Ray, seed int64) *RadianceComponents {
+	return GetRayComponents(r, this.bg, this.world, this.lights, 8, MakeSeededRandExt(seed))
+}
+
+func TestComponentsSumToRayColor(t *testing.T) {
+	s := makeLpeScene()
+	targets := MakeSeededRandExt(1)
+	for i := 0; i < 2000; i++ {
+		target := MakePoint3(targets.Between(-3, 3), targets.Between(-1, 3), targets.Between(-2, 2))
+		r := MakeRayFromPoints(MakePoint3(0, 2, 8), target, 0)
+		seed := int64(i)
+		want := GetRayColor(r, s.bg, s.world, s.lights, 8, MakeSeededRandExt(seed))
+		if got := s.components(r, seed).Sum(); got.Sub(want).Length() > 1e-9*(1+want.Length()) {
+			t.Fatalf("ray to %v: components sum to %v, beauty is %v", target, got, want)
+		}
+	}
+}
+
+func TestComponentsByFirstBounce(t *testing.T) {
+	s := makeLpeScene()
+	isZero := func(c *Vec3) bool { return *c == *noColor }
+	for seed := int64(0); seed < 50; seed++ {
+		sky := s.components(MakeRayFromDirection(MakePoint3(0, 2, 8), &Vec3{0, 1, 0}, 0), seed)
+		if *sky.Emission != *s.bg || !isZero(sky.Sum().Sub(s.bg)) {
+			t.Fatalf("a ray into the sky gave %+v", sky)
+		}
+		floor := s.components(MakeRayFromPoints(MakePoint3(0, 2, 8), MakePoint3(0, 0, 3), 0), seed)
+		if !isZero(floor.DirectSpecular) || !isZero(floor.IndirectSpecular) || !isZero(floor.Transmission) {
+			t.Fatalf("a ray onto the floor gave %+v", floor)
+		}
+		metal := s.components(MakeRayFromPoints(MakePoint3(0, 2, 8), MakePoint3(-1, 1, 0), 0), seed)
+		if !isZero(metal.DirectDiffuse) || !isZero(metal.IndirectDiffuse) || !isZero(metal.Transmission) {
+			t.Fatalf("a ray onto the metal sphere gave %+v", metal)
+		}
+	}
+}
@@ -20,6 +20,19 @@ type Material interface {
 	ScatteringPDF(r *Ray, rec *HitRecord, scattered *Ray) float64
 }
 
+// SurfaceEmitter is a Material whose emission depends on more of the hit
+// than u, v and p, e.g. the time of animated textures.
+type SurfaceEmitter interface {
+	EmittedAt(rec *HitRecord) *Vec3
+}
+
+func emittedValue(m Material, rec *HitRecord) *Vec3 {
+	if e, ok := m.(SurfaceEmitter); ok {
+		return e.EmittedAt(rec)
+	}
+	return m.Emitted(rec.u, rec.v, rec.p)
+}
+
 type materialNoPdf struct{}
 
 func (this *materialNoPdf) ScatteringPDF(r *Ray, rec *HitRecord, scattered *Ray) float64 {
@@ -43,7 +56,7 @@ func (this *Lambertian) Scatter(r *Ray, rec *HitRecord, rng *RandExt) (bool, *Sc
 	onb := BuildOnbFromW(rec.n)
 	dir := onb.Local(rng.RandomCosineDirection())
 	scattered := MakeRayFromDirection(rec.p, dir, r.Time)
-	attenuation := this.albedo.GetValue(rec.u, rec.v, rec.p)
+	attenuation := textureValue(this.albedo, rec)
 	pdf := Dot(onb.W, scattered.Direction) / math.Pi
 	return true, &ScatterRecord{scattered, false, attenuation, pdf}
 }
@@ -153,3 +166,142 @@ func (this *DiffuseLight) Scatter(r *Ray, rec *HitRecord, rng *RandExt) (bool, *
 func (this *DiffuseLight) Emitted(u, v float64, p *Point3) *Vec3 {
 	return this.emit.GetValue(u, v, p)
 }
+
+func (this *DiffuseLight) EmittedAt(rec *HitRecord) *Vec3 {
+	return textureValue(this.emit, rec)
+}
+
+type OrenNayar struct {
+	albedo Texture
+	a, b   float64
+}
+
+func MakeOrenNayar(albedo Texture, sigma float64) *OrenNayar {
+	sigma = DegreesToRadians(sigma)
+	sigma2 := sigma * sigma
+	a := 1.0 - sigma2/(2.0*(sigma2+0.33))
+	b := 0.45 * sigma2 / (sigma2 + 0.09)
+	return &OrenNayar{albedo, a, b}
+}
+
+func MakeOrenNayarSolidColor(albedo *Vec3, sigma float64) *OrenNayar {
+	return MakeOrenNayar(MakeSolidColor(albedo), sigma)
+}
+
+func (this *OrenNayar) Scatter(r *Ray, rec *HitRecord, rng *RandExt) (bool, *ScatterRecord) {
+	onb := BuildOnbFromW(rec.n)
+	dir := onb.Local(rng.RandomCosineDirection())
+	scattered := MakeRayFromDirection(rec.p, dir, r.Time)
+	attenuation := textureValue(this.albedo, rec)
+	pdf := Dot(onb.W, scattered.Direction) / math.Pi
+	return true, &ScatterRecord{scattered, false, attenuation, pdf}
+}
+
+func (this *OrenNayar) ScatteringPDF(r *Ray, rec *HitRecord, scattered *Ray) float64 {
+	cosI := Dot(rec.n, scattered.Direction)
+	if cosI < 0 {
+		return 0
+	}
+	wo := r.Direction.Mul(-1.0).Normalize()
+	cosO := Clamp(Dot(rec.n, wo), 0.0, 1.0)
+	sinI := math.Sqrt(Max(0.0, 1.0-cosI*cosI))
+	sinO := math.Sqrt(Max(0.0, 1.0-cosO*cosO))
+	maxCos := 0.0
+	if sinI > 1e-4 && sinO > 1e-4 {
+		ti := scattered.Direction.Sub(rec.n.Mul(cosI)).Normalize()
+		to := wo.Sub(rec.n.Mul(cosO)).Normalize()
+		maxCos = Max(0.0, Dot(ti, to))
+	}
+	var sinAlpha, tanBeta float64
+	if cosI > cosO {
+		sinAlpha = sinO
+		tanBeta = sinI / cosI
+	} else {
+		sinAlpha = sinI
+		tanBeta = sinO / Max(cosO, 1e-4)
+	}
+	return cosI / math.Pi * (this.a + this.b*maxCos*sinAlpha*tanBeta)
+}
+
+func (this *OrenNayar) Emitted(u, v float64, p *Point3) *Vec3 {
+	return noColor
+}
+
+type CoatedDiffuse struct {
+	albedo Texture
+	ri     float64 // Index of refraction of the coat
+	fuzz   float64
+}
+
+func MakeCoatedDiffuse(albedo Texture, ri, fuzz float64) *CoatedDiffuse {
+	return &CoatedDiffuse{albedo, ri, fuzz}
+}
+
+func MakeCoatedDiffuseSolidColor(albedo *Vec3, ri, fuzz float64) *CoatedDiffuse {
+	return MakeCoatedDiffuse(MakeSolidColor(albedo), ri, fuzz)
+}
+
+func (this *CoatedDiffuse) Scatter(r *Ray, rec *HitRecord, rng *RandExt) (bool, *ScatterRecord) {
+	unitDirection := r.Direction.Normalize()
+	cosTheta := Clamp(Dot(unitDirection.Mul(-1.0), rec.n), 0.0, 1.0)
+	if reflectance(cosTheta, 1.0/this.ri) > rng.Between(0.0, 1.0) {
+		fuzz := rng.RandomInUnitSphere().Mul(this.fuzz)
+		reflected := reflect(unitDirection, rec.n).Add(fuzz)
+		scattered := MakeRayFromDirection(rec.p, reflected, r.Time)
+		return Dot(scattered.Direction, rec.n) > 0, &ScatterRecord{scattered, true, &Vec3{1.0, 1.0, 1.0}, 0.0}
+	}
+	onb := BuildOnbFromW(rec.n)
+	dir := onb.Local(rng.RandomCosineDirection())
+	scattered := MakeRayFromDirection(rec.p, dir, r.Time)
+	attenuation := textureValue(this.albedo, rec)
+	pdf := Dot(onb.W, scattered.Direction) / math.Pi
+	return true, &ScatterRecord{scattered, false, attenuation, pdf}
+}
+
+func (this *CoatedDiffuse) ScatteringPDF(r *Ray, rec *HitRecord, scattered *Ray) float64 {
+	cosine := Dot(rec.n, scattered.Direction)
+	if cosine < 0 {
+		return 0
+	}
+	return cosine / math.Pi
+}
+
+func (this *CoatedDiffuse) Emitted(u, v float64, p *Point3) *Vec3 {
+	return noColor
+}
+
+// Mix blends two materials by a weight texture. Scattering picks one of
+// them with the weight as probability and hands the hit over to it, so the
+// chosen material's own pdf applies and Mix needs none.
+type Mix struct {
+	a, b   Material
+	weight Texture
+	materialNoPdf
+}
+
+func MakeMix(a, b Material, weight Texture) *Mix {
+	return &Mix{a, b, weight, materialNoPdf{}}
+}
+
+func mixAmount(w *Vec3) float64 {
+	return Clamp((w.X+w.Y+w.Z)/3.0, 0.0, 1.0)
+}
+
+func (this *Mix) Scatter(r *Ray, rec *HitRecord, rng *RandExt) (bool, *ScatterRecord) {
+	m := this.a
+	if rng.Float64() < mixAmount(textureValue(this.weight, rec)) {
+		m = this.b
+	}
+	rec.Material = m
+	return m.Scatter(r, rec, rng)
+}
+
+func (this *Mix) Emitted(u, v float64, p *Point3) *Vec3 {
+	w := mixAmount(this.weight.GetValue(u, v, p))
+	return this.a.Emitted(u, v, p).Mul(1.0 - w).Add(this.b.Emitted(u, v, p).Mul(w))
+}
+
+func (this *Mix) EmittedAt(rec *HitRecord) *Vec3 {
+	w := mixAmount(textureValue(this.weight, rec))
+	return emittedValue(this.a, rec).Mul(1.0 - w).Add(emittedValue(this.b, rec).Mul(w))
+}
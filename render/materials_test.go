@@ -0,0 +1,112 @@
+package render
+
+import (
+	. "github.com/alexa-infra/rayme/math"
+	"math"
+	"testing"
+)
+
+// scatteringCase is a hit on the z=0 plane facing +z, seen from direction
+// wo.
+func scatteringCase(m Material, wo *Vec3) (*Ray, *HitRecord) {
+	r := MakeRayFromDirection(MakePoint3(wo.X, wo.Y, wo.Z), wo.Mul(-1), 0)
+	return r, MakeHitRecord(r, 1, MakePoint3(0, 0, 0), &Vec3{0, 0, 1}, m, 0, 0)
+}
+
+func uniformDirection(rng *RandExt) *Vec3 {
+	z := rng.Between(-1, 1)
+	phi := rng.Between(0, 2*math.Pi)
+	s := math.Sqrt(1 - z*z)
+	return &Vec3{s * math.Cos(phi), s * math.Sin(phi), z}
+}
+
+func viewDirections() []*Vec3 {
+	dirs := []*Vec3{}
+	for _, theta := range []float64{0, 30, 60, 85} {
+		t := DegreesToRadians(theta)
+		dirs = append(dirs, &Vec3{math.Sin(t), 0, math.Cos(t)})
+	}
+	return dirs
+}
+
+func TestDiffuseEnergy(t *testing.T) {
+	gray := &Vec3{0.5, 0.5, 0.5}
+	materials := map[string]Material{
+		"lambertian":  MakeLambertianSolidColor(gray),
+		"orenNayar0":  MakeOrenNayarSolidColor(gray, 0),
+		"orenNayar20": MakeOrenNayarSolidColor(gray, 20),
+		"orenNayar60": MakeOrenNayarSolidColor(gray, 60),
+		"orenNayar90": MakeOrenNayarSolidColor(gray, 90),
+		"coated":      MakeCoatedDiffuseSolidColor(gray, 1.5, 0),
+	}
+	rng := MakeRandExt(1)
+	const n = 200000
+	for name, m := range materials {
+		for _, wo := range viewDirections() {
+			r, rec := scatteringCase(m, wo)
+			sum := 0.0
+			for i := 0; i < n; i++ {
+				sum += m.ScatteringPDF(r, rec, MakeRayFromDirection(rec.p, uniformDirection(rng), 0))
+			}
+			// the estimate of a full cosine lobe is 1 within 1%
+			if total := sum / n * 4 * math.Pi; total > 1.01 {
+				t.Errorf("%s seen from %v scatters %.4f of the light", name, wo, total)
+			}
+		}
+	}
+}
+
+func TestOrenNayarReciprocity(t *testing.T) {
+	for _, sigma := range []float64{0, 20, 60} {
+		m := MakeOrenNayarSolidColor(&Vec3{0.5, 0.5, 0.5}, sigma)
+		lambertian := MakeLambertianSolidColor(&Vec3{0.5, 0.5, 0.5})
+		rng := MakeRandExt(2)
+		for i := 0; i < 1000; i++ {
+			wi, wo := uniformDirection(rng), uniformDirection(rng)
+			wi.Z, wo.Z = math.Abs(wi.Z)+0.01, math.Abs(wo.Z)+0.01
+			wi, wo = wi.Normalize(), wo.Normalize()
+			r, rec := scatteringCase(m, wo)
+			forward := m.ScatteringPDF(r, rec, MakeRayFromDirection(rec.p, wi, 0)) / wi.Z
+			r2, rec2 := scatteringCase(m, wi)
+			backward := m.ScatteringPDF(r2, rec2, MakeRayFromDirection(rec2.p, wo, 0)) / wo.Z
+			if math.Abs(forward-backward) > 1e-9 {
+				t.Fatalf("sigma %g: brdf %g one way, %g the other", sigma, forward, backward)
+			}
+			if sigma == 0 {
+				if l := lambertian.ScatteringPDF(r, rec, MakeRayFromDirection(rec.p, wi, 0)) / wi.Z; math.Abs(forward-l) > 1e-12 {
+					t.Fatalf("sigma 0: brdf %g, lambertian %g", forward, l)
+				}
+			}
+		}
+	}
+}
+
+func TestMixPicksByWeight(t *testing.T) {
+	diffuse := MakeLambertianSolidColor(&Vec3{0.5, 0.5, 0.5})
+	metal := MakeMetal(&Vec3{0.9, 0.9, 0.9}, 0)
+	m := MakeMix(diffuse, metal, MakeSolidColor(&Vec3{0.3, 0.3, 0.3}))
+	rng := MakeRandExt(3)
+	const n = 20000
+	specular := 0
+	for i := 0; i < n; i++ {
+		r, rec := scatteringCase(m, &Vec3{0, 0.6, 0.8})
+		ok, srec := m.Scatter(r, rec, rng)
+		if !ok {
+			t.Fatal("mix absorbed the ray")
+		}
+		if srec.isSpecular != (rec.Material == metal) {
+			t.Fatal("the hit does not name the material that scattered")
+		}
+		if srec.isSpecular {
+			specular++
+		}
+	}
+	if got := float64(specular) / n; math.Abs(got-0.3) > 0.02 {
+		t.Errorf("metal scattered %.3f of the rays, want 0.3", got)
+	}
+	lights := MakeMix(MakeDiffuseLightFromColor(&Vec3{0, 0, 0}), MakeDiffuseLightFromColor(&Vec3{10, 10, 10}), MakeSolidColor(&Vec3{0.3, 0.3, 0.3}))
+	_, rec := scatteringCase(lights, &Vec3{0, 0, 1})
+	if e := lights.EmittedAt(rec); math.Abs(e.X-3) > 1e-9 {
+		t.Errorf("mixed emission %v, want 3", e)
+	}
+}
@@ -20,6 +20,11 @@ type Triangle struct {
 	material   Material
 }
 
+// Mesh groups the triangles of one mesh so they share an object ID.
+type Mesh struct {
+	*Bvh
+}
+
 func MakeMeshBuilder() *MeshBuilder {
 	indexArr := []int{}
 	posArr := []*Point3{}
@@ -79,7 +84,7 @@ func (this *MeshBuilder) GetTriMesh(material Material, rng *RandExt) Hittable {
 		}
 		i += count
 	}
-	return MakeBvh(faces, 0, 1, rng)
+	return &Mesh{MakeBvh(faces, 0, 1, rng)}
 }
 
 func (this *Triangle) hit(r *Ray, tMin, tMax float64) (bool, *HitRecord) {
@@ -106,7 +111,7 @@ func (this *Triangle) hit(r *Ray, tMin, tMax float64) (bool, *HitRecord) {
 	if t < tMin || t > tMax {
 		return false, nil
 	}
-	return true, MakeHitRecord(r, t, r.At(t), this.normal, this.material, 0, 0)
+	return true, MakeHitRecord(r, t, r.At(t), this.normal, this.material, 0, 0).withTangents(edge1, edge2)
 }
 
 func (this *Triangle) boundingBox(t0, t1 float64) (bool, *Aabb) {
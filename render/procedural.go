@@ -0,0 +1,157 @@
+package render
+
+import (
+	. "github.com/alexa-infra/rayme/math"
+	"math"
+	"sort"
+)
+
+type ColorStop struct {
+	Position float64
+	Color    *Vec3
+}
+
+type ColorRamp struct {
+	stops []ColorStop
+}
+
+func MakeColorRamp(stops ...ColorStop) *ColorRamp {
+	sorted := append([]ColorStop{}, stops...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Position < sorted[j].Position
+	})
+	return &ColorRamp{sorted}
+}
+
+func MakeGrayRamp() *ColorRamp {
+	return MakeColorRamp(ColorStop{0, &Vec3{0, 0, 0}}, ColorStop{1, &Vec3{1, 1, 1}})
+}
+
+func (this *ColorRamp) Eval(t float64) *Vec3 {
+	n := len(this.stops)
+	if n == 0 {
+		return &Vec3{t, t, t}
+	}
+	if t <= this.stops[0].Position {
+		return this.stops[0].Color
+	}
+	if t >= this.stops[n-1].Position {
+		return this.stops[n-1].Color
+	}
+	for i := 1; i < n; i++ {
+		b := this.stops[i]
+		if t <= b.Position {
+			a := this.stops[i-1]
+			span := b.Position - a.Position
+			if span <= 0 {
+				return b.Color
+			}
+			s := (t - a.Position) / span
+			return a.Color.Mul(1 - s).Add(b.Color.Mul(s))
+		}
+	}
+	return this.stops[n-1].Color
+}
+
+type MarbleTexture struct {
+	perlin     *Perlin
+	scale      float64
+	turbulence float64
+	ramp       *ColorRamp
+}
+
+func MakeMarbleTexture(scale, turbulence float64, ramp *ColorRamp, rng *RandExt) *MarbleTexture {
+	return &MarbleTexture{MakePerlin(rng), scale, turbulence, ramp}
+}
+
+func (this *MarbleTexture) GetValue(u, v float64, p *Point3) *Vec3 {
+	ps := p.Mul(this.scale).AsPoint3()
+	t := 0.5 * (1 + math.Sin(ps.Z+this.turbulence*this.perlin.Turb(ps, 7)))
+	return this.ramp.Eval(t)
+}
+
+type WoodTexture struct {
+	perlin     *Perlin
+	scale      float64
+	rings      float64
+	turbulence float64
+	ramp       *ColorRamp
+}
+
+func MakeWoodTexture(scale, rings, turbulence float64, ramp *ColorRamp, rng *RandExt) *WoodTexture {
+	return &WoodTexture{MakePerlin(rng), scale, rings, turbulence, ramp}
+}
+
+func (this *WoodTexture) GetValue(u, v float64, p *Point3) *Vec3 {
+	ps := p.Mul(this.scale).AsPoint3()
+	dist := math.Sqrt(ps.X*ps.X+ps.Z*ps.Z)*this.rings + this.turbulence*this.perlin.Noise(ps)
+	return this.ramp.Eval(dist - math.Floor(dist))
+}
+
+type VoronoiMode int
+
+const (
+	VoronoiF1 VoronoiMode = iota
+	VoronoiF2
+	VoronoiEdges
+)
+
+type VoronoiTexture struct {
+	worley *Worley
+	scale  float64
+	mode   VoronoiMode
+	ramp   *ColorRamp
+}
+
+func MakeVoronoiTexture(scale float64, mode VoronoiMode, ramp *ColorRamp, rng *RandExt) *VoronoiTexture {
+	return &VoronoiTexture{MakeWorley(rng), scale, mode, ramp}
+}
+
+func (this *VoronoiTexture) GetValue(u, v float64, p *Point3) *Vec3 {
+	f1, f2 := this.worley.Noise(p.Mul(this.scale).AsPoint3())
+	t := f1
+	switch this.mode {
+	case VoronoiF2:
+		t = f2
+	case VoronoiEdges:
+		t = f2 - f1
+	}
+	return this.ramp.Eval(Clamp(t, 0.0, 1.0))
+}
+
+type FbmTexture struct {
+	perlin     *Perlin
+	scale      float64
+	octaves    int
+	lacunarity float64
+	gain       float64
+	ramp       *ColorRamp
+}
+
+func MakeFbmTexture(scale float64, octaves int, lacunarity, gain float64, ramp *ColorRamp, rng *RandExt) *FbmTexture {
+	return &FbmTexture{MakePerlin(rng), scale, octaves, lacunarity, gain, ramp}
+}
+
+func (this *FbmTexture) GetValue(u, v float64, p *Point3) *Vec3 {
+	n := this.perlin.Fbm(p.Mul(this.scale).AsPoint3(), this.octaves, this.lacunarity, this.gain)
+	return this.ramp.Eval(Clamp(0.5*(n+1), 0.0, 1.0))
+}
+
+type RidgedTexture struct {
+	perlin     *Perlin
+	scale      float64
+	octaves    int
+	lacunarity float64
+	gain       float64
+	offset     float64
+	ramp       *ColorRamp
+}
+
+func MakeRidgedTexture(scale float64, octaves int, lacunarity, gain, offset float64, ramp *ColorRamp, rng *RandExt) *RidgedTexture {
+	return &RidgedTexture{MakePerlin(rng), scale, octaves, lacunarity, gain, offset, ramp}
+}
+
+func (this *RidgedTexture) GetValue(u, v float64, p *Point3) *Vec3 {
+	n := this.perlin.Ridged(p.Mul(this.scale).AsPoint3(), this.octaves, this.lacunarity, this.gain, this.offset)
+	return this.ramp.Eval(Clamp(n, 0.0, 1.0))
+}
@@ -0,0 +1,61 @@
+package render
+
+import (
+	. "github.com/alexa-infra/rayme/math"
+	"math"
+	"testing"
+)
+
+func TestColorRamp(t *testing.T) {
+	red, blue := &Vec3{1, 0, 0}, &Vec3{0, 0, 1}
+	ramp := MakeColorRamp(ColorStop{0.8, blue}, ColorStop{0.2, red})
+	tests := []struct {
+		t    float64
+		want Vec3
+	}{
+		{-1, *red},
+		{0.2, *red},
+		{0.5, Vec3{0.5, 0, 0.5}},
+		{0.65, Vec3{0.25, 0, 0.75}},
+		{0.8, *blue},
+		{2, *blue},
+	}
+	for _, test := range tests {
+		if got := ramp.Eval(test.t); got.Sub(&test.want).Length() > 1e-9 {
+			t.Errorf("ramp at %g: %v, want %v", test.t, got, test.want)
+		}
+	}
+}
+
+func TestProceduralTextures(t *testing.T) {
+	// on a red to blue ramp every value has R + B = 1 and no green
+	ramp := MakeColorRamp(ColorStop{0, &Vec3{1, 0, 0}}, ColorStop{1, &Vec3{0, 0, 1}})
+	textures := map[string]func(rng *RandExt) Texture{
+		"marble": func(rng *RandExt) Texture { return MakeMarbleTexture(4, 5, ramp, rng) },
+		"wood":   func(rng *RandExt) Texture { return MakeWoodTexture(2, 6, 0.5, ramp, rng) },
+		"f1":     func(rng *RandExt) Texture { return MakeVoronoiTexture(3, VoronoiF1, ramp, rng) },
+		"f2":     func(rng *RandExt) Texture { return MakeVoronoiTexture(3, VoronoiF2, ramp, rng) },
+		"edges":  func(rng *RandExt) Texture { return MakeVoronoiTexture(3, VoronoiEdges, ramp, rng) },
+		"fbm":    func(rng *RandExt) Texture { return MakeFbmTexture(3, 5, 2, 0.5, ramp, rng) },
+		"ridged": func(rng *RandExt) Texture { return MakeRidgedTexture(3, 5, 2, 0.5, 1, ramp, rng) },
+	}
+	points := MakeSeededRandExt(2)
+	for name, build := range textures {
+		a, b := build(MakeSeededRandExt(7)), build(MakeSeededRandExt(7))
+		min, max := math.Inf(1), math.Inf(-1)
+		for i := 0; i < 500; i++ {
+			p := MakePoint3(points.Between(-2, 2), points.Between(-2, 2), points.Between(-2, 2))
+			c := a.GetValue(0, 0, p)
+			if math.IsNaN(c.X) || math.Abs(c.X+c.Z-1) > 1e-9 || c.Y != 0 || c.X < 0 || c.Z < 0 {
+				t.Fatalf("%s at %v: %v is off the ramp", name, p, c)
+			}
+			if d := b.GetValue(0, 0, p); *d != *c {
+				t.Fatalf("%s at %v: %v and %v from the same seed", name, p, c, d)
+			}
+			min, max = math.Min(min, c.Z), math.Max(max, c.Z)
+		}
+		if max-min < 0.2 {
+			t.Errorf("%s barely varies: %g to %g", name, min, max)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package render
+
+import (
+	. "github.com/alexa-infra/rayme/math"
+	"math"
+)
+
+type ProjectionMode int
+
+const (
+	ProjectPlanar ProjectionMode = iota
+	ProjectSpherical
+	ProjectCylindrical
+	ProjectTriplanar
+)
+
+type ProjectionAxis int
+
+const (
+	AxisX ProjectionAxis = iota
+	AxisY
+	AxisZ
+)
+
+type ProjectionSpace int
+
+const (
+	WorldSpace ProjectionSpace = iota
+	ObjectSpace
+)
+
+type ProjectionTexture struct {
+	tex       Texture
+	mode      ProjectionMode
+	axis      ProjectionAxis
+	space     ProjectionSpace
+	center    *Point3
+	scale     float64
+	sharpness float64
+}
+
+func MakePlanarProjection(tex Texture, axis ProjectionAxis, space ProjectionSpace, center *Point3, scale float64) *ProjectionTexture {
+	return &ProjectionTexture{tex, ProjectPlanar, axis, space, center, scale, 0.0}
+}
+
+func MakeSphericalProjection(tex Texture, space ProjectionSpace, center *Point3) *ProjectionTexture {
+	return &ProjectionTexture{tex, ProjectSpherical, AxisY, space, center, 1.0, 0.0}
+}
+
+func MakeCylindricalProjection(tex Texture, axis ProjectionAxis, space ProjectionSpace, center *Point3, scale float64) *ProjectionTexture {
+	return &ProjectionTexture{tex, ProjectCylindrical, axis, space, center, scale, 0.0}
+}
+
+func MakeTriplanarProjection(tex Texture, space ProjectionSpace, center *Point3, scale, sharpness float64) *ProjectionTexture {
+	return &ProjectionTexture{tex, ProjectTriplanar, AxisY, space, center, scale, sharpness}
+}
+
+func planeAxes(axis ProjectionAxis) (du, dv *Vec3) {
+	switch axis {
+	case AxisX:
+		return &Vec3{0, 0, 1}, &Vec3{0, 1, 0}
+	case AxisZ:
+		return &Vec3{1, 0, 0}, &Vec3{0, 1, 0}
+	}
+	return &Vec3{1, 0, 0}, &Vec3{0, 0, 1}
+}
+
+func (this *ProjectionTexture) planar(rec *HitRecord, q *Vec3, axis ProjectionAxis) *Vec3 {
+	du, dv := planeAxes(axis)
+	projected := rec.withUv(Dot(q, du)*this.scale, Dot(q, dv)*this.scale)
+	projected.dpdu = du.Mul(1.0 / this.scale)
+	projected.dpdv = dv.Mul(1.0 / this.scale)
+	return textureValue(this.tex, projected)
+}
+
+func (this *ProjectionTexture) spherical(rec *HitRecord, q *Vec3) *Vec3 {
+	radius := q.Length()
+	d := q.Normalize()
+	u, v := getSphereUv(d)
+	projected := rec.withUv(u, v)
+	projected.dpdu = (&Vec3{d.Z, 0, -d.X}).Mul(2.0 * math.Pi * radius)
+	projected.dpdv = Cross(d, projected.dpdu).Normalize().Mul(math.Pi * radius)
+	return textureValue(this.tex, projected)
+}
+
+func (this *ProjectionTexture) cylindrical(rec *HitRecord, q *Vec3) *Vec3 {
+	du, dv := planeAxes(this.axis)
+	w := Cross(du, dv)
+	a := Dot(q, du)
+	b := Dot(q, dv)
+	u := (math.Atan2(b, a) + math.Pi) / (2.0 * math.Pi)
+	v := Dot(q, w) * this.scale
+	projected := rec.withUv(u, v)
+	radius := math.Hypot(a, b)
+	projected.dpdu = du.Mul(-b).Add(dv.Mul(a)).Normalize().Mul(2.0 * math.Pi * radius)
+	projected.dpdv = w.Mul(1.0 / this.scale)
+	return textureValue(this.tex, projected)
+}
+
+func (this *ProjectionTexture) triplanar(rec *HitRecord, q, n *Vec3) *Vec3 {
+	wx := math.Pow(Abs(n.X), this.sharpness)
+	wy := math.Pow(Abs(n.Y), this.sharpness)
+	wz := math.Pow(Abs(n.Z), this.sharpness)
+	sum := wx + wy + wz
+	if sum <= 0 {
+		return this.planar(rec, q, AxisY)
+	}
+	result := &Vec3{0, 0, 0}
+	if wx > 0 {
+		result = result.Add(this.planar(rec, q, AxisX).Mul(wx / sum))
+	}
+	if wy > 0 {
+		result = result.Add(this.planar(rec, q, AxisY).Mul(wy / sum))
+	}
+	if wz > 0 {
+		result = result.Add(this.planar(rec, q, AxisZ).Mul(wz / sum))
+	}
+	return result
+}
+
+func (this *ProjectionTexture) project(rec *HitRecord, p *Point3, n *Vec3) *Vec3 {
+	q := GetDirection(this.center, p)
+	switch this.mode {
+	case ProjectSpherical:
+		return this.spherical(rec, q)
+	case ProjectCylindrical:
+		return this.cylindrical(rec, q)
+	case ProjectTriplanar:
+		if n != nil {
+			return this.triplanar(rec, q, n)
+		}
+		return this.planar(rec, q, AxisY)
+	}
+	return this.planar(rec, q, this.axis)
+}
+
+func (this *ProjectionTexture) GetValue(u, v float64, p *Point3) *Vec3 {
+	return this.project(&HitRecord{p: p, u: u, v: v}, p, nil)
+}
+
+func (this *ProjectionTexture) GetSurfaceValue(rec *HitRecord) *Vec3 {
+	if this.space == ObjectSpace && rec.localP != nil {
+		return this.project(rec, rec.localP, rec.localN)
+	}
+	return this.project(rec, rec.p, rec.n)
+}
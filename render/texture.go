@@ -2,16 +2,25 @@ package render
 
 import (
 	. "github.com/alexa-infra/rayme/math"
-	"image"
-	_ "image/jpeg"
 	"math"
-	"os"
 )
 
 type Texture interface {
 	GetValue(u, v float64, p *Point3) *Vec3
 }
 
+type SurfaceTexture interface {
+	Texture
+	GetSurfaceValue(rec *HitRecord) *Vec3
+}
+
+func textureValue(t Texture, rec *HitRecord) *Vec3 {
+	if st, ok := t.(SurfaceTexture); ok {
+		return st.GetSurfaceValue(rec)
+	}
+	return t.GetValue(rec.u, rec.v, rec.p)
+}
+
 type SolidColor struct {
 	color *Vec3
 }
@@ -61,45 +70,72 @@ func (this *CheckerTexture2d) GetValue(u, v float64, p *Point3) *Vec3 {
 	return this.even
 }
 
+type NoiseKind int
+
+const (
+	NoiseTurbulence NoiseKind = iota
+	NoisePerlin
+	NoiseSimplex
+	NoiseWorley
+	NoiseAnimated
+)
+
 type NoiseTexture struct {
-	perlin *Perlin
-	scale  float64
+	perlin     *Perlin
+	simplex    *Simplex
+	worley     *Worley
+	kind       NoiseKind
+	scale      float64
+	octaves    int
+	lacunarity float64
+	gain       float64
+	speed      float64
 }
 
+// DefaultNoiseSpeed is how fast animated noise changes per unit of ray time.
+const DefaultNoiseSpeed = 1.0
+
 func MakeNoiseTexture(scale float64, r *RandExt) *NoiseTexture {
-	return &NoiseTexture{MakePerlin(r), scale}
+	return MakeNoiseTextureOfKind(NoiseTurbulence, scale, 7, 2.0, 0.5, DefaultNoiseSpeed, r)
+}
+
+func MakeNoiseTextureOfKind(kind NoiseKind, scale float64, octaves int, lacunarity, gain, speed float64, r *RandExt) *NoiseTexture {
+	t := &NoiseTexture{kind: kind, scale: scale, octaves: octaves, lacunarity: lacunarity, gain: gain, speed: speed}
+	switch kind {
+	case NoiseSimplex, NoiseAnimated:
+		t.simplex = MakeSimplex(r)
+	case NoiseWorley:
+		t.worley = MakeWorley(r)
+	default:
+		t.perlin = MakePerlin(r)
+	}
+	return t
 }
 
-func (this *NoiseTexture) GetValue(u, v float64, p *Point3) *Vec3 {
+func (this *NoiseTexture) value(p *Point3, time float64) float64 {
 	ps := p.Mul(this.scale).AsPoint3()
-	noise := this.perlin.Turb(ps, 7)
-	return &Vec3{noise, noise, noise}
+	switch this.kind {
+	case NoisePerlin:
+		return 0.5 * (1.0 + this.perlin.Fbm(ps, this.octaves, this.lacunarity, this.gain))
+	case NoiseSimplex:
+		return 0.5 * (1.0 + this.simplex.Fbm(ps, this.octaves, this.lacunarity, this.gain))
+	case NoiseWorley:
+		f1, _ := this.worley.Noise(ps)
+		return f1
+	case NoiseAnimated:
+		return 0.5 * (1.0 + this.simplex.Fbm4(ps, time*this.speed, this.octaves, this.lacunarity, this.gain))
+	}
+	return this.perlin.Turb(ps, this.octaves)
 }
 
-type ImageTexture struct {
-	img image.Image
+// GetValue has no ray time, animated noise is shown at time 0. Shading
+// goes through GetSurfaceValue, which uses the time of the hit.
+func (this *NoiseTexture) GetValue(u, v float64, p *Point3) *Vec3 {
+	noise := this.value(p, 0.0)
+	return &Vec3{noise, noise, noise}
 }
 
-func MakeImageTexture(path string) (*ImageTexture, error) {
-	reader, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
-	defer reader.Close()
-	img, _, err := image.Decode(reader)
-	if err != nil {
-		return nil, err
-	}
-	return &ImageTexture{img}, nil
-}
-
-func (this *ImageTexture) GetValue(u, v float64, p *Point3) *Vec3 {
-	u = Clamp(u, 0.0, 1.0)
-	v = 1.0 - Clamp(v, 0.0, 1.0)
-	size := this.img.Bounds().Size()
-	x := int(u * float64(size.X))
-	y := int(v * float64(size.Y))
-	r, g, b, _ := this.img.At(x, y).RGBA()
-	scale := 1.0 / float64(0xffff)
-	return &Vec3{float64(r) * scale, float64(g) * scale, float64(b) * scale}
+func (this *NoiseTexture) GetSurfaceValue(rec *HitRecord) *Vec3 {
+	noise := this.value(rec.p, rec.time)
+	return &Vec3{noise, noise, noise}
 }
@@ -0,0 +1,224 @@
+package render
+
+import (
+	. "github.com/alexa-infra/rayme/math"
+	"math"
+)
+
+func (this *HitRecord) withUv(u, v float64) *HitRecord {
+	rec := *this
+	rec.u = u
+	rec.v = v
+	return &rec
+}
+
+func (this *HitRecord) withPoint(p *Point3) *HitRecord {
+	rec := *this
+	rec.p = p
+	return &rec
+}
+
+// Luminance is the Rec. 709 luminance of a linear RGB color.
+func Luminance(c *Vec3) float64 {
+	return 0.2126*c.X + 0.7152*c.Y + 0.0722*c.Z
+}
+
+type ScaleTexture struct {
+	tex    Texture
+	factor *Vec3
+}
+
+func MakeScaleTexture(tex Texture, factor *Vec3) *ScaleTexture {
+	return &ScaleTexture{tex, factor}
+}
+
+func (this *ScaleTexture) GetValue(u, v float64, p *Point3) *Vec3 {
+	return this.tex.GetValue(u, v, p).MulVec(this.factor)
+}
+
+func (this *ScaleTexture) GetSurfaceValue(rec *HitRecord) *Vec3 {
+	return textureValue(this.tex, rec).MulVec(this.factor)
+}
+
+type AddTexture struct {
+	a, b Texture
+}
+
+func MakeAddTexture(a, b Texture) *AddTexture {
+	return &AddTexture{a, b}
+}
+
+func (this *AddTexture) GetValue(u, v float64, p *Point3) *Vec3 {
+	return this.a.GetValue(u, v, p).Add(this.b.GetValue(u, v, p))
+}
+
+func (this *AddTexture) GetSurfaceValue(rec *HitRecord) *Vec3 {
+	return textureValue(this.a, rec).Add(textureValue(this.b, rec))
+}
+
+type MultiplyTexture struct {
+	a, b Texture
+}
+
+func MakeMultiplyTexture(a, b Texture) *MultiplyTexture {
+	return &MultiplyTexture{a, b}
+}
+
+func (this *MultiplyTexture) GetValue(u, v float64, p *Point3) *Vec3 {
+	return this.a.GetValue(u, v, p).MulVec(this.b.GetValue(u, v, p))
+}
+
+func (this *MultiplyTexture) GetSurfaceValue(rec *HitRecord) *Vec3 {
+	return textureValue(this.a, rec).MulVec(textureValue(this.b, rec))
+}
+
+type MixTexture struct {
+	a, b, mask Texture
+}
+
+func MakeMixTexture(a, b, mask Texture) *MixTexture {
+	return &MixTexture{a, b, mask}
+}
+
+func mixColors(a, b *Vec3, w float64) *Vec3 {
+	return a.Mul(1 - w).Add(b.Mul(w))
+}
+
+func (this *MixTexture) GetValue(u, v float64, p *Point3) *Vec3 {
+	w := mixAmount(this.mask.GetValue(u, v, p))
+	return mixColors(this.a.GetValue(u, v, p), this.b.GetValue(u, v, p), w)
+}
+
+func (this *MixTexture) GetSurfaceValue(rec *HitRecord) *Vec3 {
+	w := mixAmount(textureValue(this.mask, rec))
+	return mixColors(textureValue(this.a, rec), textureValue(this.b, rec), w)
+}
+
+type RampTexture struct {
+	tex  Texture
+	ramp *ColorRamp
+}
+
+func MakeRampTexture(tex Texture, ramp *ColorRamp) *RampTexture {
+	return &RampTexture{tex, ramp}
+}
+
+func (this *RampTexture) GetValue(u, v float64, p *Point3) *Vec3 {
+	return this.ramp.Eval(Luminance(this.tex.GetValue(u, v, p)))
+}
+
+func (this *RampTexture) GetSurfaceValue(rec *HitRecord) *Vec3 {
+	return this.ramp.Eval(Luminance(textureValue(this.tex, rec)))
+}
+
+type GradientAxis int
+
+const (
+	GradientU GradientAxis = iota
+	GradientV
+	GradientX
+	GradientY
+	GradientZ
+)
+
+type GradientTexture struct {
+	axis     GradientAxis
+	from, to float64
+	ramp     *ColorRamp
+}
+
+func MakeGradientTexture(axis GradientAxis, from, to float64, ramp *ColorRamp) *GradientTexture {
+	return &GradientTexture{axis, from, to, ramp}
+}
+
+func (this *GradientTexture) GetValue(u, v float64, p *Point3) *Vec3 {
+	x := u
+	switch this.axis {
+	case GradientV:
+		x = v
+	case GradientX:
+		x = p.X
+	case GradientY:
+		x = p.Y
+	case GradientZ:
+		x = p.Z
+	}
+	t := 0.0
+	if this.to != this.from {
+		t = (x - this.from) / (this.to - this.from)
+	}
+	return this.ramp.Eval(Clamp(t, 0.0, 1.0))
+}
+
+type UvTransform struct {
+	tex                Texture
+	offsetU, offsetV   float64
+	scaleU, scaleV     float64
+	sinTheta, cosTheta float64
+}
+
+func MakeUvTransform(tex Texture, offsetU, offsetV, scaleU, scaleV, angle float64) *UvTransform {
+	radians := DegreesToRadians(angle)
+	return &UvTransform{tex, offsetU, offsetV, scaleU, scaleV, math.Sin(radians), math.Cos(radians)}
+}
+
+func (this *UvTransform) transform(u, v float64) (float64, float64) {
+	u = u*this.scaleU + this.offsetU
+	v = v*this.scaleV + this.offsetV
+	return this.cosTheta*u - this.sinTheta*v, this.sinTheta*u + this.cosTheta*v
+}
+
+func (this *UvTransform) GetValue(u, v float64, p *Point3) *Vec3 {
+	u, v = this.transform(u, v)
+	return this.tex.GetValue(u, v, p)
+}
+
+func (this *UvTransform) GetSurfaceValue(rec *HitRecord) *Vec3 {
+	tr := rec.withUv(this.transform(rec.u, rec.v))
+	if tr.dpdu != nil && tr.dpdv != nil && this.scaleU != 0 && this.scaleV != 0 {
+		tr.dpdu = tr.dpdu.Mul(1.0 / this.scaleU)
+		tr.dpdv = tr.dpdv.Mul(1.0 / this.scaleV)
+	}
+	return textureValue(this.tex, tr)
+}
+
+type DomainWarp2d struct {
+	tex, warp Texture
+	amount    float64
+}
+
+func MakeDomainWarp2d(tex, warp Texture, amount float64) *DomainWarp2d {
+	return &DomainWarp2d{tex, warp, amount}
+}
+
+func (this *DomainWarp2d) GetValue(u, v float64, p *Point3) *Vec3 {
+	w := this.warp.GetValue(u, v, p)
+	return this.tex.GetValue(u+this.amount*(w.X-0.5), v+this.amount*(w.Y-0.5), p)
+}
+
+func (this *DomainWarp2d) GetSurfaceValue(rec *HitRecord) *Vec3 {
+	w := textureValue(this.warp, rec)
+	return textureValue(this.tex, rec.withUv(rec.u+this.amount*(w.X-0.5), rec.v+this.amount*(w.Y-0.5)))
+}
+
+type DomainWarp3d struct {
+	tex, warp Texture
+	amount    float64
+}
+
+func MakeDomainWarp3d(tex, warp Texture, amount float64) *DomainWarp3d {
+	return &DomainWarp3d{tex, warp, amount}
+}
+
+func (this *DomainWarp3d) warpPoint(w *Vec3, p *Point3) *Point3 {
+	offset := &Vec3{w.X - 0.5, w.Y - 0.5, w.Z - 0.5}
+	return p.Move(offset.Mul(2.0 * this.amount))
+}
+
+func (this *DomainWarp3d) GetValue(u, v float64, p *Point3) *Vec3 {
+	return this.tex.GetValue(u, v, this.warpPoint(this.warp.GetValue(u, v, p), p))
+}
+
+func (this *DomainWarp3d) GetSurfaceValue(rec *HitRecord) *Vec3 {
+	return textureValue(this.tex, rec.withPoint(this.warpPoint(textureValue(this.warp, rec), rec.p)))
+}
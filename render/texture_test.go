@@ -0,0 +1,23 @@
+package render
+
+import (
+	. "github.com/alexa-infra/rayme/math"
+	"testing"
+)
+
+func TestAnimatedEmission(t *testing.T) {
+	noise := MakeNoiseTextureOfKind(NoiseAnimated, 2.0, 4, 2.0, 0.5, DefaultNoiseSpeed, MakeRandExt(1))
+	light := MakeBumpMap(MakeDiffuseLightFromTexture(MakeRampTexture(noise, MakeGrayRamp())), MakeSolidColor(&Vec3{0.5, 0.5, 0.5}), 0.1)
+	world := &HittableList{Objects: []Hittable{&Sphere{MakePoint3(0, 0, 0), 1, light}}}
+	color := func(time float64) *Vec3 {
+		r := MakeRayFromPoints(MakePoint3(0.3, 0.2, 5), MakePoint3(0, 0, 0), time)
+		return GetRayColor(r, noColor, world, nil, 2, MakeRandExt(1))
+	}
+	a, b := color(0.0), color(0.5)
+	if *a == *b {
+		t.Errorf("emission %v did not change over time", a)
+	}
+	if c := color(0.5); *b != *c {
+		t.Errorf("emission at the same time gave %v and %v", b, c)
+	}
+}
@@ -11,7 +11,14 @@ type HitRecord struct {
 	n         *Vec3
 	frontFace bool
 	Material
-	u, v float64
+	u, v       float64
+	dpdu, dpdv *Vec3
+	footprint  float64
+	rayDir     *Vec3
+	localP     *Point3
+	localN     *Vec3
+	time       float64
+	object     Hittable
 }
 
 func MakeHitRecord(ray *Ray, root float64, point *Point3, normal *Vec3, material Material, u, v float64) *HitRecord {
@@ -19,7 +26,35 @@ func MakeHitRecord(ray *Ray, root float64, point *Point3, normal *Vec3, material
 	if !frontFace {
 		normal = normal.Mul(-1.0)
 	}
-	return &HitRecord{root, point, normal, frontFace, material, u, v}
+	return &HitRecord{t: root, p: point, n: normal, frontFace: frontFace, Material: material, u: u, v: v, localP: point, localN: normal}
+}
+
+func (this *HitRecord) withTangents(dpdu, dpdv *Vec3) *HitRecord {
+	this.dpdu = dpdu
+	this.dpdv = dpdv
+	return this
+}
+
+func (this *HitRecord) withLocal(inner *HitRecord) *HitRecord {
+	this.localP = inner.localP
+	this.localN = inner.localN
+	return this
+}
+
+func (this *HitRecord) tangentFrame() *Onb {
+	if this.dpdu == nil {
+		return BuildOnbFromW(this.n)
+	}
+	t := this.dpdu.Sub(this.n.Mul(Dot(this.n, this.dpdu)))
+	if t.NearZero() {
+		return BuildOnbFromW(this.n)
+	}
+	t = t.Normalize()
+	b := Cross(this.n, t)
+	if this.dpdv != nil && Dot(b, this.dpdv) < 0 {
+		b = b.Mul(-1.0)
+	}
+	return &Onb{t, b, this.n}
 }
 
 type Hittable interface {
@@ -81,7 +116,9 @@ func (this *Sphere) hit(ray *Ray, tMin, tMax float64) (bool, *HitRecord) {
 	hitPoint := ray.At(root)
 	normal := GetDirection(this.Center, hitPoint).Mul(1.0 / this.Radius)
 	u, v := getSphereUv(normal)
-	return true, MakeHitRecord(ray, root, hitPoint, normal, this.Material, u, v)
+	dpdu := (&Vec3{normal.Z, 0, -normal.X}).Mul(2.0 * math.Pi * this.Radius)
+	dpdv := Cross(normal, dpdu).Normalize().Mul(math.Pi * this.Radius)
+	return true, MakeHitRecord(ray, root, hitPoint, normal, this.Material, u, v).withTangents(dpdu, dpdv)
 }
 
 func (this *Sphere) boundingBox(t0, t1 float64) (bool, *Aabb) {
@@ -150,6 +187,16 @@ func (this *MovingSphere) random(origin *Point3, rng *RandExt) *Vec3 {
 	return &Vec3{1, 0, 0}
 }
 
+// tagObject records the outermost non-container hittable on the hit record,
+// it identifies the object in the object ID pass.
+func tagObject(obj Hittable, rec *HitRecord) {
+	switch obj.(type) {
+	case *HittableList, *Bvh:
+	default:
+		rec.object = obj
+	}
+}
+
 type HittableList struct {
 	Objects []Hittable
 }
@@ -161,6 +208,7 @@ func (this *HittableList) hit(ray *Ray, tMin, tMax float64) (bool, *HitRecord) {
 		if !hit {
 			continue
 		}
+		tagObject(object, rec)
 		if closest == nil || rec.t < closest.t {
 			closest = rec
 		}
@@ -200,34 +248,66 @@ func (this *HittableList) random(origin *Point3, rng *RandExt) *Vec3 {
 }
 
 func GetRayColor(r *Ray, bgColor *Vec3, world Hittable, lights Hittable, depth int, rng *RandExt) *Vec3 {
+	c, _ := GetRayColorAov(r, bgColor, world, lights, depth, rng, nil)
+	return c
+}
+
+// GetRayColorAov is GetRayColor that also returns the AOVs of the first
+// hit when ids is set.
+func GetRayColorAov(r *Ray, bgColor *Vec3, world Hittable, lights Hittable, depth int, rng *RandExt, ids *AovIds) (*Vec3, *Aov) {
 	if depth <= 0 {
-		return noColor
+		return noColor, missAov(ids)
 	}
 	hit, rec := world.hit(r, 0.001, 10000)
 	if !hit {
-		return bgColor
+		return bgColor, missAov(ids)
 	}
+	emitted := shadeHit(r, rec)
+	aov := hitAov(r, rec, world, ids)
+	scattered, srec := sampleScatter(r, rec, lights, rng)
+	if !scattered {
+		return emitted, aov
+	}
+	return GetRayColor(srec.specular, bgColor, world, lights, depth-1, rng).MulVec(srec.attenuation).Add(emitted), aov
+}
 
-	var emitted *Vec3
+// shadeHit fills in the ray dependent parts of the hit record and returns
+// the light emitted towards the ray.
+func shadeHit(r *Ray, rec *HitRecord) *Vec3 {
+	rec.footprint = r.Spread * rec.t
+	rec.rayDir = r.Direction
+	rec.time = r.Time
 	if rec.frontFace {
-		emitted = rec.Material.Emitted(rec.u, rec.v, rec.p)
-	} else {
-		emitted = noColor
+		return emittedValue(rec.Material, rec)
 	}
+	return noColor
+}
+
+// sampleScatter picks the continuation ray at the hit, for diffuse lobes
+// the direction is importance sampled towards the lights and the
+// attenuation is divided by its pdf.
+func sampleScatter(r *Ray, rec *HitRecord, lights Hittable, rng *RandExt) (bool, *ScatterRecord) {
 	scattered, srec := rec.Material.Scatter(r, rec, rng)
 	if !scattered {
-		return emitted
+		return false, nil
 	}
-	if !srec.isSpecular && lights != nil {
-		lightPdf := MakeHittablePdf(lights, rec.p)
-		cosinePdf := MakeCosinePdf(rec.n)
-		mixPdf := MakeMixturePdf(lightPdf, cosinePdf)
-
-		srec.specular = MakeRayFromDirection(rec.p, mixPdf.generate(rng), r.Time)
-		pdfVal := mixPdf.value(srec.specular.Direction)
+	if !srec.isSpecular {
+		pdfVal := srec.pdf
+		if lights != nil {
+			lightPdf := MakeHittablePdf(lights, rec.p)
+			cosinePdf := MakeCosinePdf(rec.n)
+			mixPdf := MakeMixturePdf(lightPdf, cosinePdf)
+
+			srec.specular = MakeRayFromDirection(rec.p, mixPdf.generate(rng), r.Time)
+			pdfVal = mixPdf.value(srec.specular.Direction)
+		}
+		if pdfVal <= 0 {
+			return false, nil
+		}
 		srec.attenuation = srec.attenuation.Mul(rec.Material.ScatteringPDF(r, rec, srec.specular)).Mul(1 / pdfVal)
 	}
-	return GetRayColor(srec.specular, bgColor, world, lights, depth-1, rng).MulVec(srec.attenuation).Add(emitted)
+	srec.specular.Sample = rng.Float64()
+	return true, srec
 }
 
 type RectXY struct {
@@ -261,7 +341,9 @@ func (this *RectXY) hit(ray *Ray, tMin, tMax float64) (bool, *HitRecord) {
 	u := (x - this.x0) / (this.x1 - this.x0)
 	v := (y - this.y0) / (this.y1 - this.y0)
 	normal := &Vec3{0, 0, 1}
-	return true, MakeHitRecord(ray, t, hitPoint, normal, this.Material, u, v)
+	dpdu := &Vec3{this.x1 - this.x0, 0, 0}
+	dpdv := &Vec3{0, this.y1 - this.y0, 0}
+	return true, MakeHitRecord(ray, t, hitPoint, normal, this.Material, u, v).withTangents(dpdu, dpdv)
 }
 
 func (this *RectXY) pdfValue(origin *Point3, v *Vec3) float64 {
@@ -311,7 +393,9 @@ func (this *RectXZ) hit(ray *Ray, tMin, tMax float64) (bool, *HitRecord) {
 	u := (x - this.x0) / (this.x1 - this.x0)
 	v := (z - this.z0) / (this.z1 - this.z0)
 	normal := &Vec3{0, 1, 0}
-	return true, MakeHitRecord(ray, t, hitPoint, normal, this.Material, u, v)
+	dpdu := &Vec3{this.x1 - this.x0, 0, 0}
+	dpdv := &Vec3{0, 0, this.z1 - this.z0}
+	return true, MakeHitRecord(ray, t, hitPoint, normal, this.Material, u, v).withTangents(dpdu, dpdv)
 }
 
 func (this *RectXZ) pdfValue(origin *Point3, v *Vec3) float64 {
@@ -361,7 +445,9 @@ func (this *RectYZ) hit(ray *Ray, tMin, tMax float64) (bool, *HitRecord) {
 	u := (y - this.y0) / (this.y1 - this.y0)
 	v := (z - this.z0) / (this.z1 - this.z0)
 	normal := &Vec3{1, 0, 0}
-	return true, MakeHitRecord(ray, t, hitPoint, normal, this.Material, u, v)
+	dpdu := &Vec3{0, this.y1 - this.y0, 0}
+	dpdv := &Vec3{0, 0, this.z1 - this.z0}
+	return true, MakeHitRecord(ray, t, hitPoint, normal, this.Material, u, v).withTangents(dpdu, dpdv)
 }
 
 func (this *RectYZ) pdfValue(origin *Point3, v *Vec3) float64 {
@@ -415,11 +501,12 @@ type Translate struct {
 
 func (this *Translate) hit(r *Ray, tMin, tMax float64) (bool, *HitRecord) {
 	ray := MakeRayFromDirection(r.Origin.Move(this.offset.Mul(-1)), r.Direction, r.Time)
+	ray.Sample = r.Sample
 	hit, rec := this.obj.hit(ray, tMin, tMax)
 	if !hit {
 		return false, nil
 	}
-	return true, MakeHitRecord(ray, rec.t, rec.p.Move(this.offset), rec.n, rec.Material, rec.u, rec.v)
+	return true, MakeHitRecord(ray, rec.t, rec.p.Move(this.offset), rec.n, rec.Material, rec.u, rec.v).withTangents(rec.dpdu, rec.dpdv).withLocal(rec)
 }
 
 func (this *Translate) boundingBox(t0, t1 float64) (bool, *Aabb) {
@@ -479,9 +566,9 @@ func (this *RotateY) boundingBox(t0, t1 float64) (bool, *Aabb) {
 
 func (this *RotateY) hit(r *Ray, tMin, tMax float64) (bool, *HitRecord) {
 	origin := MakePoint3(
-		this.cosTheta*r.Origin.X - this.sinTheta*r.Origin.Z,
+		this.cosTheta*r.Origin.X-this.sinTheta*r.Origin.Z,
 		r.Origin.Y,
-		this.sinTheta*r.Origin.X + this.cosTheta*r.Origin.Z,
+		this.sinTheta*r.Origin.X+this.cosTheta*r.Origin.Z,
 	)
 	direction := &Vec3{
 		this.cosTheta*r.Direction.X - this.sinTheta*r.Direction.Z,
@@ -490,22 +577,30 @@ func (this *RotateY) hit(r *Ray, tMin, tMax float64) (bool, *HitRecord) {
 	}
 
 	rotated := MakeRayFromDirection(origin, direction, r.Time)
+	rotated.Sample = r.Sample
 	hit, rec := this.obj.hit(rotated, tMin, tMax)
 	if !hit {
 		return false, nil
 	}
 
 	p := MakePoint3(
-		this.cosTheta*rec.p.X + this.sinTheta*rec.p.Z,
+		this.cosTheta*rec.p.X+this.sinTheta*rec.p.Z,
 		rec.p.Y,
-		-this.sinTheta*rec.p.X + this.cosTheta*rec.p.Z,
+		-this.sinTheta*rec.p.X+this.cosTheta*rec.p.Z,
 	)
-	normal := &Vec3{
-		this.cosTheta*rec.n.X + this.sinTheta*rec.n.Z,
-		rec.n.Y,
-		-this.sinTheta*rec.n.X + this.cosTheta*rec.n.Z,
+	normal := this.rotateBack(rec.n)
+	return true, MakeHitRecord(rotated, rec.t, p, normal, rec.Material, rec.u, rec.v).withTangents(this.rotateBack(rec.dpdu), this.rotateBack(rec.dpdv)).withLocal(rec)
+}
+
+func (this *RotateY) rotateBack(v *Vec3) *Vec3 {
+	if v == nil {
+		return nil
+	}
+	return &Vec3{
+		this.cosTheta*v.X + this.sinTheta*v.Z,
+		v.Y,
+		-this.sinTheta*v.X + this.cosTheta*v.Z,
 	}
-	return true, MakeHitRecord(rotated, rec.t, p, normal, rec.Material, rec.u, rec.v)
 }
 
 type FlipFace struct {
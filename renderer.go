@@ -0,0 +1,433 @@
+package main
+
+import (
+	"fmt"
+	. "github.com/alexa-infra/rayme/math"
+	. "github.com/alexa-infra/rayme/render"
+	"github.com/alexa-infra/rayme/scene"
+	"log"
+	"math"
+	"os"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// frame holds what stays fixed while an image is rendered: scene, camera,
+// sample pattern and tile layout. Renderers with fresh buffers are made
+// from it, e.g. one per remote job.
+type frame struct {
+	world, lights Hittable
+	camera        *Camera
+	bgColor       *Vec3
+	width, height int
+	samples       []*Vec3
+	filter        Filter
+	tiles         []tile
+	aovIds        *AovIds
+	hash          string
+	options       frameOptions
+}
+
+// frameOptions are the render settings that do not come from the scene.
+type frameOptions struct {
+	filter       string
+	filterRadius float64
+	tileSize     int
+	tileOrder    string
+	aov          string
+	denoise      bool
+	workers      int
+	quiet        bool
+}
+
+func flagFrameOptions() frameOptions {
+	return frameOptions{
+		filter:       *filterName,
+		filterRadius: *filterRadius,
+		tileSize:     *tileSize,
+		tileOrder:    *tileOrder,
+		aov:          *aovSpec,
+		denoise:      *denoiseOutput,
+		workers:      *workers,
+	}
+}
+
+// setupFrame builds the frame from the loaded scene and the flags.
+func setupFrame() (*frame, error) {
+	sc, source, err := flagScene()
+	if err != nil {
+		return nil, err
+	}
+	return makeFrame(sc, rng, source, flagFrameOptions())
+}
+
+// flagScene gathers the scene loaded by loadScene, source identifies it
+// in the scene hash.
+func flagScene() (*scene.Scene, []byte, error) {
+	source := []byte(fmt.Sprintf("scene %d\n", *sceneID))
+	if *sceneFile != "" {
+		data, err := os.ReadFile(*sceneFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		source = data
+	}
+	sc := &scene.Scene{
+		World:  world,
+		Lights: lights,
+		Settings: scene.Settings{
+			LookFrom:        lookFrom,
+			LookAt:          lookAt,
+			Vup:             vup,
+			Vfov:            vfov,
+			Aperture:        aperture,
+			FocusDist:       focusDist,
+			AspectRatio:     aspectRatio,
+			Background:      bgColor,
+			ImageWidth:      imageWidth,
+			SamplesPerPixel: samplesPerPixel,
+		},
+	}
+	return sc, source, nil
+}
+
+// imageSize is the resolution of the image of a scene.
+func imageSize(sc *scene.Scene) (width, height int) {
+	return sc.ImageWidth, int(float64(sc.ImageWidth) / sc.AspectRatio)
+}
+
+// makeFrame builds the frame of a scene, source identifies the scene in
+// the hash and rng draws the sample pattern.
+func makeFrame(sc *scene.Scene, rng *RandExt, source []byte, opts frameOptions) (*frame, error) {
+	filter, err := makeFilter(opts.filter, opts.filterRadius)
+	if err != nil {
+		return nil, err
+	}
+	samples := []*Vec3{&Vec3{0.0, 0.0, 0.0}}
+	for i := 0; i < sc.SamplesPerPixel; i++ {
+		samples = append(samples, sampleOffset(rng, filter))
+	}
+	width, height := imageSize(sc)
+	// raster positions are divided by width-1 and height-1
+	if width < 2 || height < 2 {
+		return nil, fmt.Errorf("image size %dx%d is too small", width, height)
+	}
+	camera := MakeCamera(sc.LookFrom, sc.LookAt, sc.Vup, sc.Vfov, sc.AspectRatio, sc.Aperture, sc.FocusDist, 0.0, 1.0)
+	camera.SetImageHeight(height)
+	tiles, err := makeTiles(width, height, opts.tileSize, opts.tileOrder)
+	if err != nil {
+		return nil, err
+	}
+	f := &frame{sc.World, sc.Lights, camera, sc.Background, width, height, samples, filter, tiles, nil, "", opts}
+	passes, err := f.makePasses()
+	if err != nil {
+		return nil, err
+	}
+	f.hash = sceneHash(source, f, passes)
+	if needsAov(passes) {
+		f.aovIds = MakeAovIds(f.world)
+	}
+	return f, nil
+}
+
+// sampleOffset draws the position of a sample relative to the pixel
+// centre, inside the pixel and the filter support. Samples then cover the
+// image evenly, and the box filter averages the samples of each pixel.
+func sampleOffset(rng *RandExt, filter Filter) *Vec3 {
+	h := math.Min(0.5, filter.Radius())
+	return &Vec3{rng.Between(-h, h), rng.Between(-h, h), 0.0}
+}
+
+func (this *frame) makePasses() ([]*aovPass, error) {
+	passes, err := parseAovPasses(this.options.aov, this.width, this.height, this.filter)
+	if err != nil {
+		return nil, err
+	}
+	if this.options.denoise {
+		passes = withDenoiseGuides(passes, this.width, this.height, this.filter)
+	}
+	return passes, nil
+}
+
+func (this *frame) newRenderer(seed int64) (*renderer, error) {
+	if this.options.workers <= 0 {
+		return nil, fmt.Errorf("worker count must be positive")
+	}
+	passes, err := this.makePasses()
+	if err != nil {
+		return nil, err
+	}
+	return &renderer{
+		frame:          this,
+		passes:         passes,
+		withAov:        needsAov(passes),
+		withComponents: needsRadianceComponents(passes),
+		film:           MakeFilm(this.width, this.height, this.filter),
+		stats:          make([]pixelStats, this.width*this.height),
+		workers:        this.options.workers,
+		seed:           seed,
+		finished:       map[tile]bool{},
+		stop:           make(chan struct{}),
+	}, nil
+}
+
+// renderer owns the buffers of one frame and renders it in passes, each
+// pass hands tiles to a pool of workers. Every tile of a pass has its own
+// random generator derived from the seed, so a pass can be interrupted and
+// finished later with the same result.
+type renderer struct {
+	*frame
+	passes         []*aovPass
+	withAov        bool
+	withComponents bool
+	film           *Film
+	stats          []pixelStats
+	workers        int
+	seed           int64
+	firstPass      int
+	pass           int
+	aovRenders     int
+	finished       map[tile]bool
+	cancelled      int32
+	cancelOnce     sync.Once
+	stop           chan struct{}
+	failOnce       sync.Once
+	err            error
+	rays           int64
+	tilesDone      int64
+}
+
+// tileRng seeds the generator of a tile in the current pass.
+func (this *renderer) tileRng(t tile) *RandExt {
+	h := uint64(this.seed)
+	for _, v := range []int{this.pass, t.x0, t.y0} {
+		h ^= uint64(v) + 0x9e3779b97f4a7c15 + h<<6 + h>>2
+	}
+	return MakeSeededRandExt(int64(h >> 1))
+}
+
+// samplesPerPixel is the average number of samples taken per pixel.
+func (this *renderer) samplesPerPixel() float64 {
+	total := 0
+	for _, p := range this.stats {
+		total += p.count
+	}
+	return float64(total) / float64(len(this.stats))
+}
+
+// cancel stops the current pass after the tiles in flight, the pass is
+// left incomplete.
+func (this *renderer) cancel() {
+	atomic.StoreInt32(&this.cancelled, 1)
+	this.cancelOnce.Do(func() { close(this.stop) })
+}
+
+// stopped is closed by cancel.
+func (this *renderer) stopped() <-chan struct{} {
+	return this.stop
+}
+
+func (this *renderer) isCancelled() bool {
+	return atomic.LoadInt32(&this.cancelled) != 0
+}
+
+// fail cancels the render because of err, the first error is kept.
+func (this *renderer) fail(err error) {
+	this.failOnce.Do(func() { this.err = err })
+	this.cancel()
+}
+
+// failure is the error that stopped the last pass, nil unless a tile
+// panicked.
+func (this *renderer) failure() error {
+	return this.err
+}
+
+// renderPixel traces the samples of the pixel at raster position (x, y).
+// The first pass uses the fixed sample pattern and fills the AOVs, later
+// passes add count random samples. Light passes take every sample, so they
+// keep summing to the beauty film.
+func (this *renderer) renderPixel(x, y int, first bool, count int, rng *RandExt) {
+	offsets := this.samples
+	if !first {
+		offsets = make([]*Vec3, count)
+		for i := range offsets {
+			offsets[i] = sampleOffset(rng, this.filter)
+		}
+	}
+	pixel := &this.stats[y*this.width+x]
+	for k, s := range offsets {
+		u := (float64(x) + s.X) / float64(this.width-1)
+		v := (float64(this.height-1-y) + s.Y) / float64(this.height-1)
+		ray := this.camera.CastRay(u, v, rng)
+		var ids *AovIds
+		if this.withAov && first {
+			ids = this.aovIds
+		}
+		var rayColor *Vec3
+		var aov *Aov
+		var components *RadianceComponents
+		if this.withComponents {
+			components, aov = GetRayComponentsAov(ray, this.bgColor, this.world, this.lights, maxDepth, rng, ids)
+			rayColor = components.Sum()
+		} else {
+			rayColor, aov = GetRayColorAov(ray, this.bgColor, this.world, this.lights, maxDepth, rng, ids)
+		}
+		sx, sy := float64(x)+s.X, float64(y)-s.Y
+		pixel.add(rayColor)
+		this.film.AddSample(sx, sy, rayColor)
+		addAovSample(this.passes, x, y, sx, sy, aov, components, first && k == 0)
+	}
+	atomic.AddInt64(&this.rays, int64(len(offsets)))
+}
+
+// renderPass renders every pixel selected by needed, with count samples
+// per pixel after the first pass, and returns how many there were. Tiles
+// without such pixels, or finished before an interruption, are skipped.
+func (this *renderer) renderPass(label string, count int, needed func(p *pixelStats) bool) int {
+	first := this.pass == 0
+	work := []tile{}
+	active := 0
+	for _, t := range this.tiles {
+		if this.finished[t] {
+			continue
+		}
+		n := 0
+		for y := t.y0; y < t.y1; y++ {
+			for x := t.x0; x < t.x1; x++ {
+				if needed(&this.stats[y*this.width+x]) {
+					n++
+				}
+			}
+		}
+		if n > 0 {
+			work = append(work, t)
+			active += n
+		}
+	}
+	if active == 0 {
+		return 0
+	}
+	in := make(chan tile, len(work))
+	for _, t := range work {
+		in <- t
+	}
+	close(in)
+	progress := startProgress(label, len(work), &this.rays, this.options.quiet)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < this.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range in {
+				if this.isCancelled() || !this.renderTile(t, first, count, needed) {
+					continue
+				}
+				mutex.Lock()
+				this.finished[t] = true
+				mutex.Unlock()
+				progress.tileDone()
+				atomic.AddInt64(&this.tilesDone, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	progress.stop()
+	if !this.isCancelled() {
+		this.pass++
+		this.finished = map[tile]bool{}
+	}
+	return active
+}
+
+// renderTile renders the needed pixels of t. A panic, e.g. from a broken
+// scene, fails the render instead of the process and leaves the tile
+// unfinished.
+func (this *renderer) renderTile(t tile, first bool, count int, needed func(p *pixelStats) bool) (ok bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			log.Printf("tile at %d,%d: %v\n%s", t.x0, t.y0, v, debug.Stack())
+			this.fail(fmt.Errorf("rendering the tile at %d,%d failed: %v", t.x0, t.y0, v))
+		}
+	}()
+	rng := this.tileRng(t)
+	for y := t.y0; y < t.y1; y++ {
+		for x := t.x0; x < t.x1; x++ {
+			if needed(&this.stats[y*this.width+x]) {
+				this.renderPixel(x, y, first, count, rng)
+			}
+		}
+	}
+	return true
+}
+
+// progress prints a status line with finished tiles, throughput and ETA
+// while a pass is running, unless quiet.
+type progress struct {
+	label      string
+	quiet      bool
+	total      int
+	done       int64
+	rays       *int64
+	startRays  int64
+	start      time.Time
+	quit, exit chan struct{}
+}
+
+func startProgress(label string, total int, rays *int64, quiet bool) *progress {
+	p := &progress{
+		label:     label,
+		quiet:     quiet,
+		total:     total,
+		rays:      rays,
+		startRays: atomic.LoadInt64(rays),
+		start:     time.Now(),
+		quit:      make(chan struct{}),
+		exit:      make(chan struct{}),
+	}
+	go func() {
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p.print()
+			case <-p.quit:
+				p.print()
+				if !p.quiet {
+					fmt.Fprintln(os.Stderr)
+				}
+				close(p.exit)
+				return
+			}
+		}
+	}()
+	return p
+}
+
+func (this *progress) tileDone() {
+	atomic.AddInt64(&this.done, 1)
+}
+
+func (this *progress) stop() {
+	close(this.quit)
+	<-this.exit
+}
+
+func (this *progress) print() {
+	if this.quiet {
+		return
+	}
+	done := atomic.LoadInt64(&this.done)
+	elapsed := time.Since(this.start)
+	rate := float64(atomic.LoadInt64(this.rays)-this.startRays) / elapsed.Seconds()
+	eta := "--"
+	if done > 0 {
+		remaining := time.Duration(float64(elapsed) / float64(done) * float64(int64(this.total)-done))
+		eta = remaining.Round(time.Second).String()
+	}
+	fmt.Fprintf(os.Stderr, "\r%s: %d/%d tiles, %.2f Mrays/s, ETA %s   ", this.label, done, this.total, rate/1e6, eta)
+}
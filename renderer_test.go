@@ -0,0 +1,93 @@
+package main
+
+import (
+	. "github.com/alexa-infra/rayme/math"
+	. "github.com/alexa-infra/rayme/render"
+	"github.com/alexa-infra/rayme/scene"
+	"math"
+	"testing"
+)
+
+const testScene = `{
+	"camera": {"lookFrom": [0, 2, 8], "lookAt": [0, 1, 0], "vfov": 40, "aspectRatio": 1.5},
+	"image": {"width": 24, "samples": 4},
+	"background": [0.2, 0.3, 0.5],
+	"materials": {"light": {"type": "light", "emit": [4, 4, 4]}},
+	"objects": [
+		{"type": "rectXZ", "min": [-10, -10], "max": [10, 10], "k": 0, "material": {"type": "lambertian", "albedo": 0.5}},
+		{"type": "sphere", "center": [-1, 1, 0], "radius": 1, "material": {"type": "metal", "albedo": [0.8, 0.8, 0.8], "fuzz": 0.2}},
+		{"type": "sphere", "center": [1.2, 0.8, 0.5], "radius": 0.8, "material": {"type": "dielectric", "ior": 1.5}},
+		{"type": "rectXZ", "min": [-2, -2], "max": [2, 2], "k": 5, "material": "light", "flip": true}
+	],
+	"lights": [{"type": "rectXZ", "min": [-2, -2], "max": [2, 2], "k": 5}]
+}`
+
+func testOptions(filter, aov string) frameOptions {
+	return frameOptions{filter: filter, tileSize: 8, tileOrder: "scanline", aov: aov, workers: 2, quiet: true}
+}
+
+func testRenderer(t *testing.T, opts frameOptions, seed int64) *renderer {
+	sc, err := scene.Parse([]byte(testScene), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := makeFrame(sc, MakeRandExt(1), []byte(testScene), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := f.newRenderer(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func renderPasses(r *renderer, passes int) {
+	for r.pass < passes {
+		r.renderPass("test", len(r.samples), func(p *pixelStats) bool { return true })
+	}
+}
+
+func TestBoxFilterAveragesPixels(t *testing.T) {
+	r := testRenderer(t, testOptions("box", ""), 1)
+	renderPasses(r, 2)
+	img := r.film.Image()
+	for i, p := range r.stats {
+		c := &Vec3{float64(img.Pix[3*i]), float64(img.Pix[3*i+1]), float64(img.Pix[3*i+2])}
+		mean := p.lum / float64(p.count)
+		if d := math.Abs(Luminance(c) - mean); d > 1e-5*math.Max(1, mean) {
+			t.Fatalf("pixel %d: film %g, mean of its samples %g", i, Luminance(c), mean)
+		}
+	}
+}
+
+func TestLightPassesSumToBeauty(t *testing.T) {
+	for _, filter := range []string{"box", "gaussian"} {
+		r := testRenderer(t, testOptions(filter, "light"), 1)
+		renderPasses(r, 3)
+		beauty := r.film.Image()
+		sum := make([]float64, len(beauty.Pix))
+		for _, pass := range r.passes {
+			for i, v := range pass.image().Pix {
+				sum[i] += float64(v)
+			}
+		}
+		for i, v := range beauty.Pix {
+			if d := math.Abs(sum[i] - float64(v)); d > 1e-4*math.Max(1, float64(v)) {
+				t.Fatalf("%s: light passes sum to %g, beauty is %g", filter, sum[i], v)
+			}
+		}
+	}
+}
+
+func TestPanicFailsRender(t *testing.T) {
+	r := testRenderer(t, testOptions("box", ""), 1)
+	r.camera = nil
+	r.renderPass("test", len(r.samples), func(p *pixelStats) bool { return true })
+	if r.failure() == nil || !r.isCancelled() {
+		t.Fatalf("render went on after a panic: %v", r.failure())
+	}
+	if r.pass != 0 {
+		t.Errorf("failed pass was counted")
+	}
+}
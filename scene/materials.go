@@ -0,0 +1,71 @@
+package scene
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/alexa-infra/rayme/math"
+	"github.com/alexa-infra/rayme/render"
+)
+
+func (l *loader) material(raw json.RawMessage) (render.Material, error) {
+	var name string
+	if err := json.Unmarshal(raw, &name); err == nil {
+		return l.namedMaterial(name)
+	}
+	p, err := l.parseParams(raw)
+	if err != nil {
+		return nil, err
+	}
+	m := l.buildMaterial(p)
+	if p.err != nil {
+		return nil, p.err
+	}
+	return m, nil
+}
+
+func (l *loader) namedMaterial(name string) (render.Material, error) {
+	if m, ok := l.materials[name]; ok {
+		return m, nil
+	}
+	raw, ok := l.file.Materials[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown material %q", name)
+	}
+	key := "material:" + name
+	if l.pending[key] {
+		return nil, fmt.Errorf("material %q references itself", name)
+	}
+	l.pending[key] = true
+	m, err := l.material(raw)
+	delete(l.pending, key)
+	if err != nil {
+		return nil, fmt.Errorf("material %q: %v", name, err)
+	}
+	l.materials[name] = m
+	return m, nil
+}
+
+func (l *loader) buildMaterial(p *params) render.Material {
+	switch p.kind {
+	case "lambertian":
+		return render.MakeLambertianTexture(p.texture("albedo"))
+	case "orenNayar":
+		return render.MakeOrenNayar(p.texture("albedo"), p.float("sigma", 20.0))
+	case "metal":
+		return render.MakeMetal(p.vec("albedo", &Vec3{0.8, 0.8, 0.8}), p.float("fuzz", 0.0))
+	case "dielectric":
+		return render.MakeDielectric(p.float("ior", 1.5))
+	case "light":
+		return render.MakeDiffuseLightFromTexture(p.texture("emit"))
+	case "coated":
+		return render.MakeCoatedDiffuse(p.texture("albedo"), p.float("ior", 1.5), p.float("fuzz", 0.0))
+	case "mix":
+		return render.MakeMix(p.material("a"), p.material("b"), p.texture("weight"))
+	case "normalMap":
+		return render.MakeNormalMap(p.material("material"), p.texture("normals"), p.float("strength", 1.0))
+	case "bumpMap":
+		return render.MakeBumpMap(p.material("material"), p.texture("height"), p.float("scale", 0.05))
+	}
+	p.fail("type", fmt.Errorf("unknown material type %q", p.kind))
+	return nil
+}
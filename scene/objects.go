@@ -0,0 +1,115 @@
+package scene
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/alexa-infra/rayme/render"
+)
+
+func (l *loader) objects(list []json.RawMessage) ([]render.Hittable, error) {
+	result := []render.Hittable{}
+	for i, raw := range list {
+		obj, err := l.object(raw)
+		if err != nil {
+			return nil, fmt.Errorf("object %d: %v", i, err)
+		}
+		result = append(result, obj)
+	}
+	return result, nil
+}
+
+func (l *loader) object(raw json.RawMessage) (render.Hittable, error) {
+	p, err := l.parseParams(raw)
+	if err != nil {
+		return nil, err
+	}
+	obj := l.buildObject(p)
+	if p.err != nil {
+		return nil, p.err
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("empty object %q", p.kind)
+	}
+	if raw, ok := p.fields["cutout"]; ok {
+		cp, err := l.parseParamsUntyped(raw)
+		if err != nil {
+			return nil, err
+		}
+		if cp.bool("stochastic", false) {
+			obj = render.MakeStochasticCutout(obj, cp.texture("alpha"))
+		} else {
+			obj = render.MakeCutout(obj, cp.texture("alpha"), cp.float("threshold", 0.5))
+		}
+		if cp.err != nil {
+			return nil, cp.err
+		}
+	}
+	if p.has("rotateY") {
+		obj = render.MakeRotateY(obj, p.float("rotateY", 0.0))
+	}
+	if p.has("translate") {
+		obj = render.MakeTranslate(obj, p.point("translate").Vec3)
+	}
+	if p.bool("flip", false) {
+		obj = render.MakeFlipFace(obj)
+	}
+	return obj, p.err
+}
+
+func (l *loader) parseParamsUntyped(raw json.RawMessage) (*params, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	return &params{"cutout", fields, l, nil}, nil
+}
+
+func (l *loader) buildObject(p *params) render.Hittable {
+	switch p.kind {
+	case "sphere":
+		return &render.Sphere{Center: p.point("center"), Radius: p.float("radius", 1.0), Material: p.objectMaterial()}
+	case "movingSphere":
+		return &render.MovingSphere{
+			Center0:  p.point("center0"),
+			Center1:  p.point("center1"),
+			Radius:   p.float("radius", 1.0),
+			Time0:    p.float("time0", 0.0),
+			Time1:    p.float("time1", 1.0),
+			Material: p.objectMaterial(),
+		}
+	case "rectXY":
+		a, b := p.floats("min", 2), p.floats("max", 2)
+		return render.MakeRectXY(a[0], a[1], b[0], b[1], p.float("k", 0.0), p.objectMaterial())
+	case "rectXZ":
+		a, b := p.floats("min", 2), p.floats("max", 2)
+		return render.MakeRectXZ(a[0], a[1], b[0], b[1], p.float("k", 0.0), p.objectMaterial())
+	case "rectYZ":
+		a, b := p.floats("min", 2), p.floats("max", 2)
+		return render.MakeRectYZ(a[0], a[1], b[0], b[1], p.float("k", 0.0), p.objectMaterial())
+	case "box":
+		return render.MakeBox(p.point("min"), p.point("max"), p.objectMaterial())
+	case "sphereMesh":
+		return render.MakeSphereMesh(p.objectMaterial(), p.float("radius", 1.0), p.int("segments", 32), l.rng)
+	case "list":
+		var list []json.RawMessage
+		if err := json.Unmarshal(p.fields["objects"], &list); err != nil {
+			p.fail("objects", err)
+			return nil
+		}
+		objects, err := l.objects(list)
+		if err != nil {
+			p.fail("objects", err)
+			return nil
+		}
+		if len(objects) == 0 {
+			p.fail("objects", fmt.Errorf("empty list"))
+			return nil
+		}
+		if p.bool("bvh", false) {
+			return render.MakeBvh(objects, 0.0, 1.0, l.rng)
+		}
+		return &render.HittableList{Objects: objects}
+	}
+	p.fail("type", fmt.Errorf("unknown object type %q", p.kind))
+	return nil
+}
@@ -0,0 +1,194 @@
+package scene
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/alexa-infra/rayme/math"
+	"github.com/alexa-infra/rayme/render"
+)
+
+type params struct {
+	kind   string
+	fields map[string]json.RawMessage
+	l      *loader
+	err    error
+}
+
+func (l *loader) parseParams(raw json.RawMessage) (*params, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	p := &params{"", fields, l, nil}
+	p.kind = p.str("type", "")
+	if p.kind == "" {
+		return nil, fmt.Errorf("missing type in %s", string(raw))
+	}
+	return p, nil
+}
+
+func (p *params) fail(key string, err error) {
+	if p.err == nil {
+		p.err = fmt.Errorf("%s.%s: %v", p.kind, key, err)
+	}
+}
+
+func (p *params) has(key string) bool {
+	_, ok := p.fields[key]
+	return ok
+}
+
+func (p *params) str(key, def string) string {
+	raw, ok := p.fields[key]
+	if !ok {
+		return def
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		p.fail(key, err)
+		return def
+	}
+	return s
+}
+
+func (p *params) float(key string, def float64) float64 {
+	raw, ok := p.fields[key]
+	if !ok {
+		return def
+	}
+	var f float64
+	if err := json.Unmarshal(raw, &f); err != nil {
+		p.fail(key, err)
+		return def
+	}
+	return f
+}
+
+func (p *params) int(key string, def int) int {
+	return int(p.float(key, float64(def)))
+}
+
+func (p *params) bool(key string, def bool) bool {
+	raw, ok := p.fields[key]
+	if !ok {
+		return def
+	}
+	var b bool
+	if err := json.Unmarshal(raw, &b); err != nil {
+		p.fail(key, err)
+		return def
+	}
+	return b
+}
+
+func (p *params) floats(key string, n int) []float64 {
+	raw, ok := p.fields[key]
+	if !ok {
+		p.fail(key, fmt.Errorf("missing"))
+		return make([]float64, n)
+	}
+	var arr []float64
+	if err := json.Unmarshal(raw, &arr); err != nil {
+		p.fail(key, err)
+		return make([]float64, n)
+	}
+	if len(arr) != n {
+		p.fail(key, fmt.Errorf("expected %d numbers, got %d", n, len(arr)))
+		return make([]float64, n)
+	}
+	return arr
+}
+
+func (p *params) vec(key string, def *Vec3) *Vec3 {
+	raw, ok := p.fields[key]
+	if !ok {
+		return def
+	}
+	v, err := parseVec(raw)
+	if err != nil {
+		p.fail(key, err)
+		return def
+	}
+	return v
+}
+
+func (p *params) point(key string) *Point3 {
+	a := p.floats(key, 3)
+	return MakePoint3(a[0], a[1], a[2])
+}
+
+func (p *params) texture(key string) render.Texture {
+	raw, ok := p.fields[key]
+	if !ok {
+		p.fail(key, fmt.Errorf("missing"))
+		return render.MakeSolidColor(&Vec3{0, 0, 0})
+	}
+	t, err := p.l.texture(raw)
+	if err != nil {
+		p.fail(key, err)
+		return render.MakeSolidColor(&Vec3{0, 0, 0})
+	}
+	return t
+}
+
+func (p *params) material(key string) render.Material {
+	raw, ok := p.fields[key]
+	if !ok {
+		p.fail(key, fmt.Errorf("missing"))
+		return nil
+	}
+	m, err := p.l.material(raw)
+	if err != nil {
+		p.fail(key, err)
+	}
+	return m
+}
+
+// objectMaterial is the material of an object. Entries of the lights list
+// only give the shapes to sample towards, they may leave it out.
+func (p *params) objectMaterial() render.Material {
+	if p.l.shapesOnly && !p.has("material") {
+		return nil
+	}
+	return p.material("material")
+}
+
+func (p *params) ramp(key string) *render.ColorRamp {
+	raw, ok := p.fields[key]
+	if !ok {
+		return render.MakeGrayRamp()
+	}
+	var stops []struct {
+		At    float64         `json:"at"`
+		Color json.RawMessage `json:"color"`
+	}
+	if err := json.Unmarshal(raw, &stops); err != nil {
+		p.fail(key, err)
+		return render.MakeGrayRamp()
+	}
+	result := []render.ColorStop{}
+	for _, s := range stops {
+		c, err := parseVec(s.Color)
+		if err != nil {
+			p.fail(key, err)
+			return render.MakeGrayRamp()
+		}
+		result = append(result, render.ColorStop{Position: s.At, Color: c})
+	}
+	return render.MakeColorRamp(result...)
+}
+
+func parseVec(raw json.RawMessage) (*Vec3, error) {
+	var f float64
+	if err := json.Unmarshal(raw, &f); err == nil {
+		return &Vec3{f, f, f}, nil
+	}
+	var arr []float64
+	if err := json.Unmarshal(raw, &arr); err != nil {
+		return nil, err
+	}
+	if len(arr) != 3 {
+		return nil, fmt.Errorf("expected 3 numbers, got %d", len(arr))
+	}
+	return &Vec3{arr[0], arr[1], arr[2]}, nil
+}
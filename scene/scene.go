@@ -0,0 +1,198 @@
+package scene
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/alexa-infra/rayme/math"
+	"github.com/alexa-infra/rayme/render"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type Settings struct {
+	LookFrom, LookAt *Point3
+	Vup              *Vec3
+	Vfov             float64
+	Aperture         float64
+	FocusDist        float64
+	AspectRatio      float64
+	Background       *Vec3
+	ImageWidth       int
+	SamplesPerPixel  int
+}
+
+type Scene struct {
+	World, Lights render.Hittable
+	Settings
+}
+
+type sceneFile struct {
+	Camera struct {
+		LookFrom    []float64 `json:"lookFrom"`
+		LookAt      []float64 `json:"lookAt"`
+		Vup         []float64 `json:"vup"`
+		Vfov        float64   `json:"vfov"`
+		Aperture    float64   `json:"aperture"`
+		FocusDist   float64   `json:"focusDist"`
+		AspectRatio float64   `json:"aspectRatio"`
+	} `json:"camera"`
+	Image struct {
+		Width   int `json:"width"`
+		Samples int `json:"samples"`
+	} `json:"image"`
+	Background []float64                  `json:"background"`
+	Seed       int                        `json:"seed"`
+	Textures   map[string]json.RawMessage `json:"textures"`
+	Materials  map[string]json.RawMessage `json:"materials"`
+	Objects    []json.RawMessage          `json:"objects"`
+	Lights     []json.RawMessage          `json:"lights"`
+}
+
+type loader struct {
+	file      *sceneFile
+	dir       string
+	rng       *RandExt
+	textures  map[string]render.Texture
+	materials map[string]render.Material
+	pending   map[string]bool
+	// set while parsing the lights list, see params.objectMaterial
+	shapesOnly bool
+	// files must be relative paths inside dir, see ParseConfined
+	confined bool
+}
+
+func Load(path string) (*Scene, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, filepath.Dir(path))
+}
+
+// Parse loads a scene, relative file paths in it are resolved against dir.
+func Parse(data []byte, dir string) (*Scene, error) {
+	return parse(data, dir, false)
+}
+
+// ParseConfined loads a scene from an untrusted source, e.g. a network
+// request. Files it references must be relative paths that stay inside
+// root, with an empty root it may not reference files at all.
+func ParseConfined(data []byte, root string) (*Scene, error) {
+	return parse(data, root, true)
+}
+
+func parse(data []byte, dir string, confined bool) (*Scene, error) {
+	// without an explicit seed use the one of the built-in scenes
+	file := &sceneFile{Seed: 99}
+	if err := json.Unmarshal(data, file); err != nil {
+		return nil, err
+	}
+	l := &loader{
+		file,
+		dir,
+		MakeSeededRandExt(int64(file.Seed)),
+		map[string]render.Texture{},
+		map[string]render.Material{},
+		map[string]bool{},
+		false,
+		confined,
+	}
+	settings, err := parseSettings(file)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := l.objects(file.Objects)
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("scene has no objects")
+	}
+	l.shapesOnly = true
+	lightObjects, err := l.objects(file.Lights)
+	if err != nil {
+		return nil, err
+	}
+	var lights render.Hittable
+	if len(lightObjects) > 0 {
+		lights = &render.HittableList{Objects: lightObjects}
+	}
+	world := &render.HittableList{Objects: objects}
+	return &Scene{world, lights, *settings}, nil
+}
+
+// filePath resolves a path read from the scene.
+func (l *loader) filePath(path string) (string, error) {
+	if l.confined {
+		if l.dir == "" {
+			return "", fmt.Errorf("scene may not reference files")
+		}
+		clean := filepath.Clean(path)
+		if filepath.IsAbs(clean) || filepath.VolumeName(clean) != "" || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("%q is outside the scene root", path)
+		}
+	}
+	if filepath.IsAbs(path) {
+		return path, nil
+	}
+	return filepath.Join(l.dir, path), nil
+}
+
+func toVec(a []float64, def *Vec3) (*Vec3, error) {
+	if a == nil {
+		return def, nil
+	}
+	if len(a) != 3 {
+		return nil, fmt.Errorf("expected 3 numbers, got %d", len(a))
+	}
+	return &Vec3{a[0], a[1], a[2]}, nil
+}
+
+func parseSettings(file *sceneFile) (*Settings, error) {
+	cam := file.Camera
+	lookFrom, err := toVec(cam.LookFrom, &Vec3{0, 0, 10})
+	if err != nil {
+		return nil, fmt.Errorf("camera.lookFrom: %v", err)
+	}
+	lookAt, err := toVec(cam.LookAt, &Vec3{0, 0, 0})
+	if err != nil {
+		return nil, fmt.Errorf("camera.lookAt: %v", err)
+	}
+	vup, err := toVec(cam.Vup, &Vec3{0, 1, 0})
+	if err != nil {
+		return nil, fmt.Errorf("camera.vup: %v", err)
+	}
+	bg, err := toVec(file.Background, &Vec3{0, 0, 0})
+	if err != nil {
+		return nil, fmt.Errorf("background: %v", err)
+	}
+	s := &Settings{
+		lookFrom.AsPoint3(),
+		lookAt.AsPoint3(),
+		vup,
+		cam.Vfov,
+		cam.Aperture,
+		cam.FocusDist,
+		cam.AspectRatio,
+		bg,
+		file.Image.Width,
+		file.Image.Samples,
+	}
+	if s.Vfov <= 0 {
+		s.Vfov = 20.0
+	}
+	if s.FocusDist <= 0 {
+		s.FocusDist = 10.0
+	}
+	if s.AspectRatio <= 0 {
+		s.AspectRatio = 16.0 / 9.0
+	}
+	if s.ImageWidth <= 0 {
+		s.ImageWidth = 400
+	}
+	if s.SamplesPerPixel <= 0 {
+		s.SamplesPerPixel = 12
+	}
+	return s, nil
+}
@@ -0,0 +1,132 @@
+package scene
+
+import (
+	"fmt"
+	. "github.com/alexa-infra/rayme/math"
+	"github.com/alexa-infra/rayme/render"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func parseObjects(materials, objects, lights string) (*Scene, error) {
+	data := fmt.Sprintf(`{"image": {"width": 40, "samples": 1}, "materials": {%s}, "objects": [%s], "lights": [%s]}`, materials, objects, lights)
+	return Parse([]byte(data), ".")
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name, materials, objects, want string
+	}{
+		{"no objects", ``, ``, "scene has no objects"},
+		{"missing material", ``, `{"type": "sphere", "center": [0, 0, 0]}`, "sphere.material: missing"},
+		{"null material", ``, `{"type": "sphere", "center": [0, 0, 0], "material": null}`, "sphere.material"},
+		{"unknown material", ``, `{"type": "sphere", "center": [0, 0, 0], "material": "m"}`, `unknown material "m"`},
+		{"mix without b", `"m": {"type": "mix", "a": {"type": "lambertian", "albedo": 1}}`, `{"type": "sphere", "center": [0, 0, 0], "material": "m"}`, "mix.b: missing"},
+		{"normal map without material", `"m": {"type": "normalMap", "normals": 0.5}`, `{"type": "sphere", "center": [0, 0, 0], "material": "m"}`, "normalMap.material: missing"},
+		{"bump map without material", `"m": {"type": "bumpMap", "height": 0.5}`, `{"type": "sphere", "center": [0, 0, 0], "material": "m"}`, "bumpMap.material: missing"},
+		{"self reference", `"m": {"type": "normalMap", "material": "m", "normals": 0.5}`, `{"type": "sphere", "center": [0, 0, 0], "material": "m"}`, "references itself"},
+		{"unknown material type", `"m": {"type": "chrome"}`, `{"type": "sphere", "center": [0, 0, 0], "material": "m"}`, `unknown material type "chrome"`},
+		{"unknown object type", ``, `{"type": "torus"}`, `unknown object type "torus"`},
+		{"short vector", ``, `{"type": "sphere", "center": [0, 0], "material": {"type": "metal"}}`, "sphere.center"},
+		{"missing texture", `"m": {"type": "lambertian"}`, `{"type": "sphere", "center": [0, 0, 0], "material": "m"}`, "lambertian.albedo: missing"},
+		{"empty list", ``, `{"type": "list", "objects": []}`, "empty list"},
+	}
+	for _, test := range tests {
+		_, err := parseObjects(test.materials, test.objects, "")
+		if err == nil {
+			t.Errorf("%s: scene loaded", test.name)
+		} else if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got %q, want it to mention %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestLightShapesWithoutMaterial(t *testing.T) {
+	sc, err := parseObjects(`"light": {"type": "light", "emit": 4}`,
+		`{"type": "rectXZ", "min": [-1, -1], "max": [1, 1], "k": 2, "material": "light"}`,
+		`{"type": "rectXZ", "min": [-1, -1], "max": [1, 1], "k": 2}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Lights == nil {
+		t.Fatal("lights list was dropped")
+	}
+}
+
+func emittedNoise(t *testing.T, seed string) *Vec3 {
+	data := fmt.Sprintf(`{%s "objects": [{"type": "sphere", "center": [0, 0, 0],
+		"material": {"type": "light", "emit": {"type": "fbm", "scale": 3}}}]}`, seed)
+	sc, err := Parse([]byte(data), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sphere := sc.World.(*render.HittableList).Objects[0].(*render.Sphere)
+	return sphere.Material.Emitted(0.3, 0.7, MakePoint3(0.4, 0.1, 0.9))
+}
+
+func TestSeed(t *testing.T) {
+	a, b := emittedNoise(t, `"seed": 1,`), emittedNoise(t, `"seed": 1,`)
+	if *a != *b {
+		t.Errorf("same seed gave %v and %v", a, b)
+	}
+	if c := emittedNoise(t, `"seed": 2,`); *a == *c {
+		t.Errorf("seeds 1 and 2 both gave %v", a)
+	}
+	if d, e := emittedNoise(t, ``), emittedNoise(t, `"seed": 99,`); *d != *e {
+		t.Errorf("default seed gave %v, seed 99 gave %v", d, e)
+	}
+}
+
+func writeImage(t *testing.T, path string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, image.NewGray(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseConfined(t *testing.T) {
+	root, outside := t.TempDir(), t.TempDir()
+	writeImage(t, filepath.Join(root, "tex", "a.png"))
+	writeImage(t, filepath.Join(outside, "b.png"))
+	escape, err := filepath.Rel(root, filepath.Join(outside, "b.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		root, path, want string
+	}{
+		{root, "tex/a.png", ""},
+		{root, "tex/../tex/a.png", ""},
+		{root, filepath.Join(root, "tex", "a.png"), "outside the scene root"},
+		{root, escape, "outside the scene root"},
+		{root, "..", "outside the scene root"},
+		{"", "tex/a.png", "may not reference files"},
+	}
+	for _, test := range tests {
+		data := fmt.Sprintf(`{"objects": [{"type": "sphere", "center": [0, 0, 0],
+			"material": {"type": "lambertian", "albedo": {"type": "image", "path": %q}}}]}`, test.path)
+		_, err := ParseConfined([]byte(data), test.root)
+		switch {
+		case test.want == "" && err != nil:
+			t.Errorf("%s in %q: %v", test.path, test.root, err)
+		case test.want != "" && (err == nil || !strings.Contains(err.Error(), test.want)):
+			t.Errorf("%s in %q: got %v, want it to mention %q", test.path, test.root, err, test.want)
+		}
+	}
+	data := fmt.Sprintf(`{"objects": [{"type": "sphere", "center": [0, 0, 0],
+		"material": {"type": "lambertian", "albedo": {"type": "image", "path": %q}}}]}`, filepath.Join(outside, "b.png"))
+	if _, err := Parse([]byte(data), root); err != nil {
+		t.Errorf("scene files may use absolute paths: %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package scene
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/alexa-infra/rayme/math"
+	"github.com/alexa-infra/rayme/render"
+)
+
+var wrapModes = map[string]render.WrapMode{
+	"clamp":  render.WrapClamp,
+	"repeat": render.WrapRepeat,
+	"mirror": render.WrapMirror,
+}
+
+var filterModes = map[string]render.FilterMode{
+	"nearest":     render.FilterNearest,
+	"bilinear":    render.FilterBilinear,
+	"trilinear":   render.FilterTrilinear,
+	"anisotropic": render.FilterAnisotropic,
+}
+
+var voronoiModes = map[string]render.VoronoiMode{
+	"f1":    render.VoronoiF1,
+	"f2":    render.VoronoiF2,
+	"edges": render.VoronoiEdges,
+}
+
+var noiseKinds = map[string]render.NoiseKind{
+	"turbulence": render.NoiseTurbulence,
+	"perlin":     render.NoisePerlin,
+	"simplex":    render.NoiseSimplex,
+	"worley":     render.NoiseWorley,
+	"animated":   render.NoiseAnimated,
+}
+
+var gradientAxes = map[string]render.GradientAxis{
+	"u": render.GradientU,
+	"v": render.GradientV,
+	"x": render.GradientX,
+	"y": render.GradientY,
+	"z": render.GradientZ,
+}
+
+var projectionAxes = map[string]render.ProjectionAxis{
+	"x": render.AxisX,
+	"y": render.AxisY,
+	"z": render.AxisZ,
+}
+
+var projectionSpaces = map[string]render.ProjectionSpace{
+	"world":  render.WorldSpace,
+	"object": render.ObjectSpace,
+}
+
+func (l *loader) texture(raw json.RawMessage) (render.Texture, error) {
+	var name string
+	if err := json.Unmarshal(raw, &name); err == nil {
+		return l.namedTexture(name)
+	}
+	if c, err := parseVec(raw); err == nil {
+		return render.MakeSolidColor(c), nil
+	}
+	p, err := l.parseParams(raw)
+	if err != nil {
+		return nil, err
+	}
+	t := l.buildTexture(p)
+	if p.err != nil {
+		return nil, p.err
+	}
+	return t, nil
+}
+
+func (l *loader) namedTexture(name string) (render.Texture, error) {
+	if t, ok := l.textures[name]; ok {
+		return t, nil
+	}
+	raw, ok := l.file.Textures[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown texture %q", name)
+	}
+	if l.pending[name] {
+		return nil, fmt.Errorf("texture %q references itself", name)
+	}
+	l.pending[name] = true
+	t, err := l.texture(raw)
+	delete(l.pending, name)
+	if err != nil {
+		return nil, fmt.Errorf("texture %q: %v", name, err)
+	}
+	l.textures[name] = t
+	return t, nil
+}
+
+func (l *loader) buildTexture(p *params) render.Texture {
+	white := &Vec3{1, 1, 1}
+	black := &Vec3{0, 0, 0}
+	switch p.kind {
+	case "solid":
+		return render.MakeSolidColor(p.vec("color", white))
+	case "checker3d":
+		return render.MakeCheckerTexture3d(p.float("scale", 1.0), p.vec("odd", black), p.vec("even", white))
+	case "checker2d":
+		return render.MakeCheckerTexture2d(p.float("scale", 1.0), p.vec("odd", black), p.vec("even", white))
+	case "noise":
+		kind, ok := noiseKinds[p.str("kind", "turbulence")]
+		if !ok {
+			p.fail("kind", fmt.Errorf("unknown noise kind"))
+		}
+		octaves := p.int("octaves", 7)
+		return render.MakeNoiseTextureOfKind(kind, p.float("scale", 1.0), octaves, p.float("lacunarity", 2.0), p.float("gain", 0.5), p.float("speed", render.DefaultNoiseSpeed), l.rng)
+	case "image":
+		path, err := l.filePath(p.str("path", ""))
+		if err != nil {
+			p.fail("path", err)
+			return nil
+		}
+		wrap, ok := wrapModes[p.str("wrap", "clamp")]
+		if !ok {
+			p.fail("wrap", fmt.Errorf("unknown wrap mode"))
+		}
+		filter, ok := filterModes[p.str("filter", "bilinear")]
+		if !ok {
+			p.fail("filter", fmt.Errorf("unknown filter"))
+		}
+		var t *render.ImageTexture
+		switch p.str("colorSpace", "srgb") {
+		case "srgb":
+			t, err = render.MakeFilteredImageTexture(path, wrap, filter)
+		case "raw":
+			t, err = render.MakeDataImageTexture(path, wrap, filter)
+		default:
+			p.fail("colorSpace", fmt.Errorf("unknown color space"))
+			return nil
+		}
+		if err != nil {
+			p.fail("path", err)
+			return nil
+		}
+		return t
+	case "marble":
+		return render.MakeMarbleTexture(p.float("scale", 1.0), p.float("turbulence", 5.0), p.ramp("ramp"), l.rng)
+	case "wood":
+		return render.MakeWoodTexture(p.float("scale", 1.0), p.float("rings", 4.0), p.float("turbulence", 1.0), p.ramp("ramp"), l.rng)
+	case "voronoi":
+		mode, ok := voronoiModes[p.str("mode", "f1")]
+		if !ok {
+			p.fail("mode", fmt.Errorf("unknown voronoi mode"))
+		}
+		return render.MakeVoronoiTexture(p.float("scale", 1.0), mode, p.ramp("ramp"), l.rng)
+	case "fbm":
+		return render.MakeFbmTexture(p.float("scale", 1.0), p.int("octaves", 6), p.float("lacunarity", 2.0), p.float("gain", 0.5), p.ramp("ramp"), l.rng)
+	case "ridged":
+		return render.MakeRidgedTexture(p.float("scale", 1.0), p.int("octaves", 6), p.float("lacunarity", 2.0), p.float("gain", 2.0), p.float("offset", 1.0), p.ramp("ramp"), l.rng)
+	case "scale":
+		return render.MakeScaleTexture(p.texture("texture"), p.vec("factor", white))
+	case "add":
+		return render.MakeAddTexture(p.texture("a"), p.texture("b"))
+	case "multiply":
+		return render.MakeMultiplyTexture(p.texture("a"), p.texture("b"))
+	case "mix":
+		return render.MakeMixTexture(p.texture("a"), p.texture("b"), p.texture("mask"))
+	case "ramp":
+		return render.MakeRampTexture(p.texture("texture"), p.ramp("ramp"))
+	case "gradient":
+		axis, ok := gradientAxes[p.str("axis", "u")]
+		if !ok {
+			p.fail("axis", fmt.Errorf("unknown gradient axis"))
+		}
+		return render.MakeGradientTexture(axis, p.float("from", 0.0), p.float("to", 1.0), p.ramp("ramp"))
+	case "uvTransform":
+		offset := []float64{0, 0}
+		if p.has("offset") {
+			offset = p.floats("offset", 2)
+		}
+		scale := []float64{1, 1}
+		if p.has("scale") {
+			scale = p.floats("scale", 2)
+		}
+		return render.MakeUvTransform(p.texture("texture"), offset[0], offset[1], scale[0], scale[1], p.float("rotate", 0.0))
+	case "warp2d":
+		return render.MakeDomainWarp2d(p.texture("texture"), p.texture("warp"), p.float("amount", 0.1))
+	case "warp3d":
+		return render.MakeDomainWarp3d(p.texture("texture"), p.texture("warp"), p.float("amount", 0.1))
+	case "projection":
+		axis, ok := projectionAxes[p.str("axis", "y")]
+		if !ok {
+			p.fail("axis", fmt.Errorf("unknown projection axis"))
+		}
+		space, ok := projectionSpaces[p.str("space", "world")]
+		if !ok {
+			p.fail("space", fmt.Errorf("unknown projection space"))
+		}
+		center := MakePoint3(0, 0, 0)
+		if p.has("center") {
+			center = p.point("center")
+		}
+		tex := p.texture("texture")
+		scale := p.float("scale", 1.0)
+		switch p.str("mode", "planar") {
+		case "planar":
+			return render.MakePlanarProjection(tex, axis, space, center, scale)
+		case "spherical":
+			return render.MakeSphericalProjection(tex, space, center)
+		case "cylindrical":
+			return render.MakeCylindricalProjection(tex, axis, space, center, scale)
+		case "triplanar":
+			return render.MakeTriplanarProjection(tex, space, center, scale, p.float("sharpness", 4.0))
+		}
+		p.fail("mode", fmt.Errorf("unknown projection mode"))
+		return nil
+	}
+	p.fail("type", fmt.Errorf("unknown texture type %q", p.kind))
+	return nil
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/alexa-infra/rayme/denoise"
+	"github.com/alexa-infra/rayme/imageio"
+	. "github.com/alexa-infra/rayme/math"
+	"github.com/alexa-infra/rayme/scene"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobDone      = "done"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+// jobSettings override the image settings of the posted scene and pick
+// the render options, zero values keep the defaults.
+type jobSettings struct {
+	Width        int     `json:"width"`
+	Samples      int     `json:"samples"`
+	Passes       int     `json:"passes"`
+	Seed         int64   `json:"seed"`
+	TimeLimit    string  `json:"timeLimit"`
+	Filter       string  `json:"filter"`
+	FilterRadius float64 `json:"filterRadius"`
+	Aov          string  `json:"aov"`
+	Denoise      bool    `json:"denoise"`
+}
+
+type jobRequest struct {
+	Scene    json.RawMessage `json:"scene"`
+	Settings jobSettings     `json:"settings"`
+}
+
+// jobStatus is what GET /jobs/{id} reports.
+type jobStatus struct {
+	Id              string     `json:"id"`
+	Status          string     `json:"status"`
+	Error           string     `json:"error,omitempty"`
+	Progress        float64    `json:"progress"`
+	Passes          int        `json:"passes"`
+	SamplesPerPixel float64    `json:"samplesPerPixel"`
+	Created         time.Time  `json:"created"`
+	Started         *time.Time `json:"started,omitempty"`
+	Finished        *time.Time `json:"finished,omitempty"`
+}
+
+type serverJob struct {
+	sync.Mutex
+	id                string
+	frame             *frame
+	settings          jobSettings
+	timeLimit         time.Duration
+	status            string
+	err               string
+	r                 *renderer
+	cancelled         bool
+	created           time.Time
+	started, finished time.Time
+}
+
+func (this *serverJob) info() jobStatus {
+	this.Lock()
+	defer this.Unlock()
+	s := jobStatus{Id: this.id, Status: this.status, Error: this.err, Created: this.created}
+	if !this.started.IsZero() {
+		s.Started = &this.started
+	}
+	if !this.finished.IsZero() {
+		s.Finished = &this.finished
+	}
+	switch {
+	case this.status == jobRunning:
+		// only the counters are safe to read while the passes run
+		tiles := atomic.LoadInt64(&this.r.tilesDone)
+		s.Passes = int(tiles) / len(this.frame.tiles)
+		s.SamplesPerPixel = float64(atomic.LoadInt64(&this.r.rays)) / float64(this.frame.width*this.frame.height)
+		if this.timeLimit > 0 {
+			s.Progress = float64(time.Since(this.started)) / float64(this.timeLimit)
+		} else {
+			s.Progress = float64(tiles) / float64(this.settings.Passes*len(this.frame.tiles))
+		}
+	case this.r != nil:
+		s.Passes = this.r.pass
+		s.SamplesPerPixel = this.r.samplesPerPixel()
+		if this.status == jobDone {
+			s.Progress = 1
+		}
+	}
+	if s.Progress > 1 {
+		s.Progress = 1
+	}
+	return s
+}
+
+// cancel drops a queued job or stops a running one after the tiles in
+// flight, it tells if there was anything to cancel.
+func (this *serverJob) cancel() bool {
+	this.Lock()
+	defer this.Unlock()
+	switch this.status {
+	case jobQueued:
+		this.status, this.finished = jobCancelled, time.Now()
+	case jobRunning:
+		this.r.cancel()
+	default:
+		return false
+	}
+	this.cancelled = true
+	return true
+}
+
+// jobLimits bound the resources a posted job may ask for.
+type jobLimits struct {
+	size, samples, passes int
+	body                  int64
+}
+
+func flagJobLimits() jobLimits {
+	return jobLimits{size: *maxJobSize, samples: *maxJobSamples, passes: *maxJobPasses, body: *maxRequestSize}
+}
+
+// server runs posted render jobs, at most -max-jobs at once. Jobs wait
+// in a queue of -queue-size, further jobs are refused until it drains.
+// The last -keep-jobs finished jobs are kept.
+type server struct {
+	sync.Mutex
+	dir    string
+	root   string
+	keep   int
+	limits jobLimits
+	jobs   map[string]*serverJob
+	queue  chan *serverJob
+	nextId int
+}
+
+func serveCommand(args []string) error {
+	flag.CommandLine.Parse(args)
+	if *maxJobs <= 0 || *queueSize < 0 || *keepJobs < 0 {
+		return fmt.Errorf("-max-jobs must be positive, -queue-size and -keep-jobs not negative")
+	}
+	// jobs may ask for denoising
+	if err := denoiseOptions().Check(); err != nil {
+		return err
+	}
+	dir := *jobsDir
+	if dir == "" {
+		var err error
+		if dir, err = os.MkdirTemp("", "rayme-jobs"); err != nil {
+			return err
+		}
+	} else if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	s := &server{dir: dir, root: *sceneRoot, keep: *keepJobs, limits: flagJobLimits(), jobs: map[string]*serverJob{}, queue: make(chan *serverJob, *queueSize)}
+	for i := 0; i < *maxJobs; i++ {
+		go func() {
+			for job := range s.queue {
+				s.run(job)
+			}
+		}()
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jobs", s.handleJobs)
+	mux.HandleFunc("/jobs/", s.handleJob)
+	log.Printf("Serving on %s, results in %s", *listenAddr, dir)
+	return http.ListenAndServe(*listenAddr, mux)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// handleJobs lists the jobs on GET and submits one on POST.
+func (this *server) handleJobs(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		this.Lock()
+		list := []jobStatus{}
+		for i := 1; i <= this.nextId; i++ {
+			if job, ok := this.jobs[fmt.Sprint(i)]; ok {
+				list = append(list, job.info())
+			}
+		}
+		this.Unlock()
+		writeJSON(w, http.StatusOK, list)
+	case http.MethodPost:
+		req.Body = http.MaxBytesReader(w, req.Body, this.limits.body)
+		job, err := newServerJob(req, this.root, this.limits)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		this.Lock()
+		defer this.Unlock()
+		job.id = fmt.Sprint(this.nextId + 1)
+		select {
+		case this.queue <- job:
+		default:
+			http.Error(w, "job queue is full", http.StatusServiceUnavailable)
+			return
+		}
+		this.nextId++
+		this.jobs[job.id] = job
+		this.prune()
+		w.Header().Set("Location", "/jobs/"+job.id)
+		writeJSON(w, http.StatusAccepted, job.info())
+	default:
+		http.Error(w, "GET or POST", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleJob serves /jobs/{id} (GET status, DELETE cancels or removes a
+// finished job), /jobs/{id}/cancel and /jobs/{id}/result.{png,exr}.
+func (this *server) handleJob(w http.ResponseWriter, req *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/jobs/"), "/")
+	this.Lock()
+	job, ok := this.jobs[parts[0]]
+	this.Unlock()
+	if !ok || len(parts) > 2 {
+		http.NotFound(w, req)
+		return
+	}
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+	switch {
+	case action == "" && req.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, job.info())
+	case action == "" && req.Method == http.MethodDelete:
+		if job.cancel() {
+			writeJSON(w, http.StatusOK, job.info())
+			return
+		}
+		this.Lock()
+		this.remove(job)
+		this.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	case action == "cancel" && req.Method == http.MethodPost:
+		if !job.cancel() {
+			http.Error(w, "job has already finished", http.StatusConflict)
+			return
+		}
+		writeJSON(w, http.StatusOK, job.info())
+	case (action == "result.png" || action == "result.exr") && req.Method == http.MethodGet:
+		if status := job.info().Status; status != jobDone {
+			http.Error(w, "job is "+status, http.StatusConflict)
+			return
+		}
+		http.ServeFile(w, req, this.resultPath(job, filepath.Ext(action)))
+	default:
+		http.Error(w, "unknown request", http.StatusNotFound)
+	}
+}
+
+// remove forgets a finished job and deletes its results, the server must
+// be locked.
+func (this *server) remove(job *serverJob) {
+	delete(this.jobs, job.id)
+	os.Remove(this.resultPath(job, ".png"))
+	os.Remove(this.resultPath(job, ".exr"))
+}
+
+// prune removes the finished jobs beyond -keep-jobs, those that finished
+// first go first. The server must be locked.
+func (this *server) prune() {
+	finished := []*serverJob{}
+	times := map[*serverJob]time.Time{}
+	for _, job := range this.jobs {
+		if info := job.info(); info.Finished != nil {
+			finished = append(finished, job)
+			times[job] = *info.Finished
+		}
+	}
+	if len(finished) <= this.keep {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool { return times[finished[i]].Before(times[finished[j]]) })
+	for _, job := range finished[:len(finished)-this.keep] {
+		this.remove(job)
+	}
+}
+
+func (this *server) resultPath(job *serverJob, ext string) string {
+	return filepath.Join(this.dir, "job"+job.id+ext)
+}
+
+// newServerJob parses the scene and settings of a request, so that bad
+// jobs are refused before they are queued. Files in the scene are looked
+// up in root only.
+func newServerJob(req *http.Request, root string, limits jobLimits) (*serverJob, error) {
+	request := &jobRequest{}
+	if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+		return nil, err
+	}
+	if len(request.Scene) == 0 {
+		return nil, fmt.Errorf("missing scene")
+	}
+	sc, err := scene.ParseConfined(request.Scene, root)
+	if err != nil {
+		return nil, err
+	}
+	settings := request.Settings
+	if settings.Width > 0 {
+		sc.ImageWidth = settings.Width
+	}
+	if settings.Samples > 0 {
+		sc.SamplesPerPixel = settings.Samples
+	}
+	if settings.Passes <= 0 {
+		settings.Passes = 1
+	}
+	if width, height := imageSize(sc); width > limits.size || height > limits.size {
+		return nil, fmt.Errorf("image size %dx%d exceeds the limit of %d", width, height, limits.size)
+	}
+	if sc.SamplesPerPixel > limits.samples {
+		return nil, fmt.Errorf("%d samples per pixel exceed the limit of %d", sc.SamplesPerPixel, limits.samples)
+	}
+	if settings.Passes > limits.passes {
+		return nil, fmt.Errorf("%d passes exceed the limit of %d", settings.Passes, limits.passes)
+	}
+	if settings.Seed == 0 {
+		settings.Seed = 1
+	}
+	if settings.Filter == "" {
+		settings.Filter = "box"
+	}
+	var timeLimit time.Duration
+	if settings.TimeLimit != "" {
+		if timeLimit, err = time.ParseDuration(settings.TimeLimit); err != nil {
+			return nil, err
+		}
+	}
+	opts := flagFrameOptions()
+	opts.filter, opts.filterRadius = settings.Filter, settings.FilterRadius
+	opts.aov, opts.denoise = settings.Aov, settings.Denoise
+	opts.quiet = true
+	f, err := makeFrame(sc, MakeRandExt(seed), request.Scene, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &serverJob{frame: f, settings: settings, timeLimit: timeLimit, status: jobQueued, created: time.Now()}, nil
+}
+
+func (this *server) run(job *serverJob) {
+	job.Lock()
+	if job.status != jobQueued {
+		job.Unlock()
+		return
+	}
+	r, err := job.frame.newRenderer(job.settings.Seed)
+	if err != nil {
+		job.status, job.err, job.finished = jobFailed, err.Error(), time.Now()
+		job.Unlock()
+		return
+	}
+	job.r, job.status, job.started = r, jobRunning, time.Now()
+	job.Unlock()
+	if job.timeLimit > 0 {
+		timer := time.AfterFunc(job.timeLimit, r.cancel)
+		defer timer.Stop()
+	}
+	for !r.isCancelled() && (job.timeLimit > 0 || r.pass < job.settings.Passes) {
+		if r.renderPass(fmt.Sprintf("Job %s pass %d", job.id, r.pass+1), len(r.samples), func(p *pixelStats) bool { return true }) == 0 {
+			break
+		}
+	}
+	job.Lock()
+	cancelled := job.cancelled
+	job.Unlock()
+	err = r.failure()
+	if err == nil && !cancelled {
+		err = this.writeResult(job, r)
+	}
+	job.Lock()
+	job.finished = time.Now()
+	if err != nil {
+		job.status, job.err = jobFailed, err.Error()
+	} else if cancelled {
+		job.status = jobCancelled
+	} else {
+		job.status = jobDone
+	}
+	job.Unlock()
+	this.Lock()
+	this.prune()
+	this.Unlock()
+}
+
+func (this *server) writeResult(job *serverJob, r *renderer) error {
+	meta := imageio.Metadata{
+		"samplesPerPixel": fmt.Sprintf("%.2f", r.samplesPerPixel()),
+		"passes":          fmt.Sprint(r.pass),
+		"renderTime":      fmt.Sprintf("%.2fs", time.Since(job.started).Seconds()),
+		"seed":            fmt.Sprint(r.seed),
+	}
+	img := r.film.Image()
+	if job.settings.Denoise {
+		var err error
+		if img, err = denoise.Denoise(img, denoiseGuides(r.passes), denoiseOptions()); err != nil {
+			return err
+		}
+	}
+	if err := writeOutputWithMetadata(this.resultPath(job, ".png"), img, meta); err != nil {
+		return err
+	}
+	return writeRender(this.resultPath(job, ".exr"), img, r.passes, meta)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func postServerJob(s *server, scene, settings string) *httptest.ResponseRecorder {
+	body := fmt.Sprintf(`{"scene": %s, "settings": %s}`, scene, settings)
+	w := httptest.NewRecorder()
+	s.handleJobs(w, httptest.NewRequest(http.MethodPost, "/jobs", strings.NewReader(body)))
+	return w
+}
+
+func TestServerKeepsLastJobs(t *testing.T) {
+	s := &server{dir: t.TempDir(), keep: 2, limits: flagJobLimits(), jobs: map[string]*serverJob{}, queue: make(chan *serverJob, 1)}
+	for i := 0; i < 4; i++ {
+		if w := postServerJob(s, testScene, `{"width": 8, "samples": 1}`); w.Code != http.StatusAccepted {
+			t.Fatalf("job %d: %d %s", i+1, w.Code, w.Body)
+		}
+		s.run(<-s.queue)
+	}
+	if len(s.jobs) != 2 || s.jobs["3"] == nil || s.jobs["4"] == nil {
+		t.Fatalf("kept jobs %v, want 3 and 4", s.jobs)
+	}
+	for _, id := range []string{"1", "2"} {
+		if _, err := os.Stat(s.resultPath(&serverJob{id: id}, ".png")); !os.IsNotExist(err) {
+			t.Errorf("result of job %s was kept: %v", id, err)
+		}
+	}
+	if _, err := os.Stat(s.resultPath(s.jobs["4"], ".exr")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServerRefusesFilesOutsideRoot(t *testing.T) {
+	s := &server{dir: t.TempDir(), limits: flagJobLimits(), jobs: map[string]*serverJob{}, queue: make(chan *serverJob, 1)}
+	scene := `{"objects": [{"type": "sphere", "center": [0, 0, 0],
+		"material": {"type": "lambertian", "albedo": {"type": "image", "path": "/etc/passwd"}}}]}`
+	w := postServerJob(s, scene, `{}`)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "may not reference files") {
+		t.Errorf("got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestServerRefusesBadSizes(t *testing.T) {
+	s := &server{dir: t.TempDir(), limits: flagJobLimits(), jobs: map[string]*serverJob{}, queue: make(chan *serverJob, 1)}
+	s.limits.body = 4096
+	tests := []struct {
+		scene, settings, want string
+	}{
+		{testScene, `{"width": 1}`, "too small"},
+		{testScene, `{"width": 100000}`, "exceeds the limit"},
+		{strings.Replace(testScene, `"aspectRatio": 1.5`, `"aspectRatio": 0.001`, 1), `{"width": 100}`, "exceeds the limit"},
+		{testScene, `{"samples": 100000}`, "exceed the limit"},
+		{testScene, `{"passes": 100000}`, "exceed the limit"},
+		{testScene, fmt.Sprintf(`{"filter": "%s"}`, strings.Repeat("x", 5000)), "too large"},
+	}
+	for _, test := range tests {
+		w := postServerJob(s, test.scene, test.settings)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), test.want) {
+			t.Errorf("want %q: got %d %s", test.want, w.Code, w.Body)
+		}
+	}
+	if len(s.jobs) != 0 {
+		t.Errorf("%d jobs were accepted", len(s.jobs))
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// tile is a rectangle of pixels in raster space (y down), x1 and y1 are
+// exclusive.
+type tile struct {
+	x0, y0, x1, y1 int
+}
+
+func makeTiles(width, height, size int, order string) ([]tile, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("tile size must be positive")
+	}
+	tilesX := (width + size - 1) / size
+	tilesY := (height + size - 1) / size
+	type cell struct {
+		tx, ty int
+		key    float64
+	}
+	cells := []cell{}
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			cells = append(cells, cell{tx, ty, 0})
+		}
+	}
+	switch order {
+	case "scanline":
+	case "spiral":
+		// rings around the centre tile, each ring walked by angle
+		cx, cy := float64(tilesX-1)/2, float64(tilesY-1)/2
+		for i := range cells {
+			dx, dy := float64(cells[i].tx)-cx, float64(cells[i].ty)-cy
+			ring := math.Max(math.Abs(dx), math.Abs(dy))
+			angle := math.Atan2(dy, dx) + math.Pi
+			cells[i].key = math.Floor(ring)*8 + angle
+		}
+	case "hilbert":
+		n := 1
+		for n < tilesX || n < tilesY {
+			n *= 2
+		}
+		for i := range cells {
+			cells[i].key = float64(hilbertIndex(n, cells[i].tx, cells[i].ty))
+		}
+	default:
+		return nil, fmt.Errorf("unknown tile order %q", order)
+	}
+	sort.SliceStable(cells, func(i, j int) bool {
+		return cells[i].key < cells[j].key
+	})
+	tiles := make([]tile, len(cells))
+	for i, c := range cells {
+		x0, y0 := c.tx*size, c.ty*size
+		tiles[i] = tile{x0, y0, minInt(x0+size, width), minInt(y0+size, height)}
+	}
+	return tiles, nil
+}
+
+// hilbertIndex is the distance of (x, y) along the Hilbert curve filling
+// an n by n grid, n is a power of two.
+func hilbertIndex(n, x, y int) int {
+	d := 0
+	for s := n / 2; s > 0; s /= 2 {
+		rx, ry := 0, 0
+		if x&s != 0 {
+			rx = 1
+		}
+		if y&s != 0 {
+			ry = 1
+		}
+		d += s * s * ((3 * rx) ^ ry)
+		if ry == 0 {
+			if rx == 1 {
+				x = n - 1 - x
+				y = n - 1 - y
+			}
+			x, y = y, x
+		}
+	}
+	return d
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+func TestTilesCoverImage(t *testing.T) {
+	for _, order := range []string{"scanline", "spiral", "hilbert"} {
+		for _, size := range [][3]int{{37, 23, 8}, {37, 23, 16}, {64, 64, 8}, {5, 3, 32}, {100, 7, 1}} {
+			width, height := size[0], size[1]
+			tiles, err := makeTiles(width, height, size[2], order)
+			if err != nil {
+				t.Fatal(err)
+			}
+			covered := make([]int, width*height)
+			for _, tl := range tiles {
+				if tl.x0 >= tl.x1 || tl.y0 >= tl.y1 {
+					t.Fatalf("%s %v: empty tile %v", order, size, tl)
+				}
+				for y := tl.y0; y < tl.y1; y++ {
+					for x := tl.x0; x < tl.x1; x++ {
+						covered[y*width+x]++
+					}
+				}
+			}
+			for i, n := range covered {
+				if n != 1 {
+					t.Fatalf("%s %v: pixel %d,%d is in %d tiles", order, size, i%width, i/width, n)
+				}
+			}
+		}
+	}
+}
+
+func TestTileOrders(t *testing.T) {
+	hilbert, _ := makeTiles(64, 64, 8, "hilbert")
+	for i := 1; i < len(hilbert); i++ {
+		a, b := hilbert[i-1], hilbert[i]
+		if d := absInt(a.x0-b.x0) + absInt(a.y0-b.y0); d != 8 {
+			t.Fatalf("hilbert jumps from %v to %v", a, b)
+		}
+	}
+	spiral, _ := makeTiles(40, 40, 8, "spiral")
+	if spiral[0] != (tile{16, 16, 24, 24}) {
+		t.Errorf("spiral starts at %v", spiral[0])
+	}
+	if _, err := makeTiles(40, 40, 8, "random"); err == nil {
+		t.Errorf("unknown order was accepted")
+	}
+	if _, err := makeTiles(40, 40, 0, "scanline"); err == nil {
+		t.Errorf("zero tile size was accepted")
+	}
+}
+
+func absInt(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/alexa-infra/rayme/imageio"
+)
+
+// tonemapCommand re-encodes an archived linear image, so a render can be
+// tone mapped again without re-rendering. It takes the display and output
+// flags of a render (-exposure, -tonemap, -white, -exr-type,
+// -exr-compression).
+func tonemapCommand(args []string) error {
+	fs := flag.NewFlagSet("tonemap", flag.ExitOnError)
+	for _, name := range []string{"exposure", "tonemap", "white", "exr-type", "exr-compression"} {
+		f := flag.CommandLine.Lookup(name)
+		fs.Var(f.Value, f.Name, f.Usage)
+	}
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: rayme tonemap [-exposure stops] [-tonemap operator] [-white value] input output")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("tonemap needs input and output images")
+	}
+	img, err := imageio.ReadImage(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return writeOutput(fs.Arg(1), img)
+}
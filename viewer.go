@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/alexa-infra/rayme/imageio"
+	. "github.com/alexa-infra/rayme/math"
+	"github.com/alexa-infra/rayme/scene"
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//go:embed viewer.html
+var viewerPage []byte
+
+// viewState is sent to the page after every image update.
+type viewState struct {
+	Version         int     `json:"version"`
+	Width           int     `json:"width"`
+	Height          int     `json:"height"`
+	Passes          int     `json:"passes"`
+	SamplesPerPixel float64 `json:"samplesPerPixel"`
+	Elapsed         float64 `json:"elapsed"`
+	PassTime        float64 `json:"passTime"`
+	Rendering       bool    `json:"rendering"`
+}
+
+// orbit places the camera relative to the scene's own view: yaw and pitch
+// in degrees around the look-at point, zoom scales the distance to it.
+type orbit struct {
+	Yaw   float64 `json:"yaw"`
+	Pitch float64 `json:"pitch"`
+	Zoom  float64 `json:"zoom"`
+}
+
+// viewer renders the scene progressively and publishes the image after
+// every pass, and twice a second while one is running. A view change
+// cancels the render and starts the accumulation over.
+type viewer struct {
+	sync.Mutex
+	sc        *scene.Scene
+	source    []byte
+	opts      frameOptions
+	maxPasses int
+	view      orbit
+	changed   chan struct{}
+	r         *renderer
+	state     viewState
+	png       []byte
+	listeners map[chan struct{}]bool
+}
+
+func viewCommand(args []string) error {
+	flag.CommandLine.Parse(args)
+	if err := loadScene(); err != nil {
+		return err
+	}
+	sc, source, err := flagScene()
+	if err != nil {
+		return err
+	}
+	opts := flagFrameOptions()
+	opts.quiet = true
+	v := &viewer{
+		sc:        sc,
+		source:    source,
+		opts:      opts,
+		view:      orbit{Zoom: 1},
+		changed:   make(chan struct{}, 1),
+		listeners: map[chan struct{}]bool{},
+	}
+	// without an explicit -passes the view refines until it changes
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "passes" {
+			v.maxPasses = *passCount
+		}
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/" {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(viewerPage)
+	})
+	mux.HandleFunc("/image.png", v.handleImage)
+	mux.HandleFunc("/events", v.handleEvents)
+	mux.HandleFunc("/camera", v.handleCamera)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- v.run()
+	}()
+	go func() {
+		log.Printf("Viewer on http://localhost%s", *listenAddr)
+		errs <- http.ListenAndServe(*listenAddr, mux)
+	}()
+	return <-errs
+}
+
+// camera moves the scene's camera by the orbit.
+func (this *viewer) camera(view orbit) *scene.Scene {
+	sc := *this.sc
+	offset := GetDirection(sc.LookAt, sc.LookFrom)
+	up := sc.Vup.Normalize()
+	dir := offset.Normalize()
+	ref := dir.Sub(up.Mul(Dot(dir, up)))
+	if ref.NearZero() {
+		ref = BuildOnbFromW(up).Local(&Vec3{1, 0, 0})
+	}
+	ref = ref.Normalize()
+	side := Cross(up, ref)
+	elevation := math.Asin(math.Max(-1, math.Min(1, Dot(dir, up))))
+	elevation += view.Pitch * math.Pi / 180
+	limit := 89 * math.Pi / 180
+	elevation = math.Max(-limit, math.Min(limit, elevation))
+	yaw := view.Yaw * math.Pi / 180
+	horizontal := ref.Mul(math.Cos(yaw)).Add(side.Mul(math.Sin(yaw)))
+	dir = horizontal.Mul(math.Cos(elevation)).Add(up.Mul(math.Sin(elevation)))
+	sc.LookFrom = sc.LookAt.Move(dir.Mul(offset.Length() * view.Zoom))
+	return &sc
+}
+
+func (this *viewer) run() error {
+	for {
+		select {
+		case <-this.changed:
+		default:
+		}
+		r, err := this.restart()
+		if err != nil {
+			return err
+		}
+		start := time.Now()
+		done := make(chan struct{})
+		go func() {
+			ticker := time.NewTicker(500 * time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					this.publish(r, start, 0, true)
+				case <-done:
+					return
+				}
+			}
+		}()
+		for !r.isCancelled() && (this.maxPasses <= 0 || r.pass < this.maxPasses) {
+			passStart := time.Now()
+			if r.renderPass(fmt.Sprintf("Pass %d", r.pass+1), len(r.samples), func(p *pixelStats) bool { return true }) == 0 {
+				break
+			}
+			if !r.isCancelled() {
+				this.publish(r, start, time.Since(passStart), true)
+			}
+		}
+		close(done)
+		if err := r.failure(); err != nil {
+			return err
+		}
+		if !r.isCancelled() {
+			this.publish(r, start, 0, false)
+			<-this.changed
+		}
+	}
+}
+
+// restart makes the renderer of the current view, a view change from now
+// on cancels it.
+func (this *viewer) restart() (*renderer, error) {
+	this.Lock()
+	defer this.Unlock()
+	f, err := makeFrame(this.camera(this.view), MakeRandExt(seed), this.source, this.opts)
+	if err != nil {
+		return nil, err
+	}
+	this.r, err = f.newRenderer(*renderSeed)
+	return this.r, err
+}
+
+// publish encodes the current image and wakes the event streams.
+func (this *viewer) publish(r *renderer, start time.Time, passTime time.Duration, rendering bool) {
+	transform, err := displayTransform()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	buf := &bytes.Buffer{}
+	if err := imageio.WritePNG(buf, transform.ToImage(r.film.Image()), nil); err != nil {
+		log.Println(err)
+		return
+	}
+	this.Lock()
+	defer this.Unlock()
+	if this.r != r {
+		return
+	}
+	state := this.state
+	state.Version++
+	state.Width, state.Height = r.width, r.height
+	state.Passes = int(atomic.LoadInt64(&r.tilesDone)) / len(r.tiles)
+	state.SamplesPerPixel = float64(atomic.LoadInt64(&r.rays)) / float64(r.width*r.height)
+	state.Elapsed = time.Since(start).Seconds()
+	if passTime > 0 {
+		state.PassTime = passTime.Seconds()
+	} else if state.Passes == 0 {
+		state.PassTime = 0
+	}
+	state.Rendering = rendering
+	this.state, this.png = state, buf.Bytes()
+	for ch := range this.listeners {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (this *viewer) handleImage(w http.ResponseWriter, req *http.Request) {
+	this.Lock()
+	png := this.png
+	this.Unlock()
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(png)
+}
+
+// handleEvents streams the view state as server-sent events.
+func (this *viewer) handleEvents(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	ch := make(chan struct{}, 1)
+	ch <- struct{}{}
+	this.Lock()
+	this.listeners[ch] = true
+	this.Unlock()
+	defer func() {
+		this.Lock()
+		delete(this.listeners, ch)
+		this.Unlock()
+	}()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	for {
+		select {
+		case <-ch:
+			this.Lock()
+			data, _ := json.Marshal(this.state)
+			this.Unlock()
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
+
+// handleCamera returns the orbit on GET and sets it on POST, which starts
+// the accumulation over.
+func (this *viewer) handleCamera(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		view := orbit{Zoom: 1}
+		if err := json.NewDecoder(req.Body).Decode(&view); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if view.Zoom <= 0 {
+			http.Error(w, "zoom must be positive", http.StatusBadRequest)
+			return
+		}
+		this.Lock()
+		this.view = view
+		if this.r != nil {
+			this.r.cancel()
+		}
+		this.Unlock()
+		select {
+		case this.changed <- struct{}{}:
+		default:
+		}
+	default:
+		http.Error(w, "GET or POST", http.StatusMethodNotAllowed)
+		return
+	}
+	this.Lock()
+	view := this.view
+	this.Unlock()
+	writeJSON(w, http.StatusOK, view)
+}
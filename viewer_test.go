@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	. "github.com/alexa-infra/rayme/math"
+	"github.com/alexa-infra/rayme/scene"
+	"image/png"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testViewer(t *testing.T, maxPasses int) *viewer {
+	sc, err := scene.Parse([]byte(testScene), ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &viewer{
+		sc:        sc,
+		source:    []byte(testScene),
+		opts:      testOptions("box", ""),
+		maxPasses: maxPasses,
+		view:      orbit{Zoom: 1},
+		changed:   make(chan struct{}, 1),
+		listeners: map[chan struct{}]bool{},
+	}
+}
+
+func TestViewerOrbit(t *testing.T) {
+	v := testViewer(t, 0)
+	at, from := v.sc.LookAt, v.sc.LookFrom
+	distance := GetDirection(at, from).Length()
+	samePoint := func(name string, got, want *Point3) {
+		t.Helper()
+		if d := GetDirection(got, want).Length(); d > 1e-9 {
+			t.Errorf("%s: camera at %v, want %v", name, got, want)
+		}
+	}
+	samePoint("still", v.camera(orbit{Zoom: 1}).LookFrom, from)
+	// the test camera looks along -z from (0, 2, 8) at (0, 1, 0)
+	samePoint("half turn", v.camera(orbit{Yaw: 180, Zoom: 1}).LookFrom, MakePoint3(0, 2, -8))
+	samePoint("zoom", v.camera(orbit{Zoom: 2}).LookFrom, MakePoint3(0, 3, 16))
+	top := v.camera(orbit{Pitch: 180, Zoom: 1}).LookFrom
+	if d := GetDirection(at, top); math.Abs(d.Length()-distance) > 1e-9 || d.Y/d.Length() < math.Cos(2*math.Pi/180) {
+		t.Errorf("pitch past the pole put the camera at %v", top)
+	}
+	if *v.sc.LookFrom != *from {
+		t.Errorf("orbit moved the scene camera to %v", v.sc.LookFrom)
+	}
+}
+
+func TestViewerRendersPasses(t *testing.T) {
+	v := testViewer(t, 2)
+	events := make(chan struct{}, 1)
+	v.listeners[events] = true
+	go v.run()
+	// wait returns the state once a render newer than version has finished
+	wait := func(version int) viewState {
+		t.Helper()
+		deadline := time.After(30 * time.Second)
+		for {
+			select {
+			case <-events:
+				v.Lock()
+				state := v.state
+				v.Unlock()
+				if state.Version > version && !state.Rendering {
+					return state
+				}
+			case <-deadline:
+				t.Fatal("the view did not finish")
+			}
+		}
+	}
+	state := wait(0)
+	if state.Passes != 2 || state.Width != 24 || state.Height != 16 || state.SamplesPerPixel < 8 {
+		t.Fatalf("finished with %+v", state)
+	}
+	w := httptest.NewRecorder()
+	v.handleImage(w, httptest.NewRequest(http.MethodGet, "/image.png", nil))
+	img, err := png.Decode(bytes.NewReader(w.Body.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 24 || b.Dy() != 16 {
+		t.Errorf("image is %v", b)
+	}
+
+	for _, bad := range []string{`{"zoom": 0}`, `{"yaw": "left"}`} {
+		w = httptest.NewRecorder()
+		v.handleCamera(w, httptest.NewRequest(http.MethodPost, "/camera", strings.NewReader(bad)))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("camera %s: %d %s", bad, w.Code, w.Body)
+		}
+	}
+	w = httptest.NewRecorder()
+	v.handleCamera(w, httptest.NewRequest(http.MethodPost, "/camera", strings.NewReader(`{"yaw": 90, "zoom": 1.5}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("camera: %d %s", w.Code, w.Body)
+	}
+	moved := wait(state.Version)
+	if moved.Passes != 2 {
+		t.Errorf("after the view change: %+v", moved)
+	}
+}